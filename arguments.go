@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bnmcg/kugo/configuration"
+)
+
+// knownExecutableFlags describes how commonly wrapped executables select their kubeconfig, context and user
+var knownExecutableFlags = map[string]configuration.ExecutableFlags{
+	"kubectl": {
+		Context:    []string{"--context"},
+		Kubeconfig: []string{"--kubeconfig"},
+		User:       []string{"--user"},
+	},
+	"helm": {
+		Context:    []string{"--kube-context"},
+		Kubeconfig: []string{"--kubeconfig"},
+	},
+}
+
+// secretFlags take credentials as their value in commonly wrapped executables, such as kubectl's --token and helm's
+// --password, and are redacted whenever arguments are logged
+var secretFlags = []string{"--token", "--password", "--pass"}
+
+// redactedArgument replaces the value of a secret flag when arguments are logged
+const redactedArgument = "<redacted>"
+
+// KubernetesSelection holds the kubeconfig, context and user chosen on the command line of a wrapped executable
+type KubernetesSelection struct {
+	Context    string
+	Kubeconfig string
+	User       string
+}
+
+// executableFlags finds the flags used by the given executable, preferring any configured in .kugo.yaml
+func executableFlags(executable string, configured map[string]configuration.ExecutableFlags) (configuration.ExecutableFlags, bool) {
+	name := filepath.Base(executable)
+	if flags, ok := configured[name]; ok {
+		return flags, true
+	}
+
+	flags, ok := knownExecutableFlags[name]
+	return flags, ok
+}
+
+// ParseKubernetesSelection looks through the arguments passed to a wrapped executable for flags selecting the
+// kubeconfig, context or user. Both "--flag value" and "--flag=value" forms are understood, and parsing stops at "--".
+func ParseKubernetesSelection(arguments []string, flags configuration.ExecutableFlags) KubernetesSelection {
+	selection := KubernetesSelection{}
+
+	for index := 0; index < len(arguments); index++ {
+		if arguments[index] == "--" {
+			break
+		}
+
+		if value, consumed, ok := matchFlag(arguments[index:], flags.Context); ok {
+			selection.Context = value
+			index += consumed
+		} else if value, consumed, ok := matchFlag(arguments[index:], flags.Kubeconfig); ok {
+			selection.Kubeconfig = value
+			index += consumed
+		} else if value, consumed, ok := matchFlag(arguments[index:], flags.User); ok {
+			selection.User = value
+			index += consumed
+		}
+	}
+
+	return selection
+}
+
+// matchFlag checks whether the first argument is one of the named flags, returning its value and the number of
+// following arguments consumed by it
+func matchFlag(arguments []string, names []string) (string, int, bool) {
+	for _, name := range names {
+		if arguments[0] == name && len(arguments) > 1 {
+			return arguments[1], 1, true
+		}
+
+		if strings.HasPrefix(arguments[0], name+"=") {
+			return strings.TrimPrefix(arguments[0], name+"="), 0, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// redactArguments returns a copy of the arguments with the values of secret flags replaced, so they may be logged
+func redactArguments(arguments []string) []string {
+	redacted := append([]string{}, arguments...)
+
+	for index := 0; index < len(redacted); index++ {
+		for _, name := range secretFlags {
+			if redacted[index] == name && index+1 < len(redacted) {
+				index++
+				redacted[index] = redactedArgument
+				break
+			}
+
+			if strings.HasPrefix(redacted[index], name+"=") {
+				redacted[index] = name + "=" + redactedArgument
+				break
+			}
+		}
+	}
+
+	return redacted
+}
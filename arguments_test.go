@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bnmcg/kugo/configuration"
+)
+
+func TestKubectlSelectionParsing(t *testing.T) {
+	flags, ok := executableFlags("kubectl", nil)
+	if !ok {
+		t.Fatal("kubectl flags are not known")
+	}
+
+	selection := ParseKubernetesSelection([]string{"get", "pods", "--context", "prod", "--kubeconfig=/tmp/prod", "--user=admin"}, flags)
+
+	if selection.Context != "prod" {
+		t.Error("Incorrect context parsed")
+	}
+
+	if selection.Kubeconfig != "/tmp/prod" {
+		t.Error("Incorrect kubeconfig parsed")
+	}
+
+	if selection.User != "admin" {
+		t.Error("Incorrect user parsed")
+	}
+}
+
+func TestHelmSelectionParsing(t *testing.T) {
+	flags, ok := executableFlags("/usr/local/bin/helm", nil)
+	if !ok {
+		t.Fatal("helm flags are not known")
+	}
+
+	selection := ParseKubernetesSelection([]string{"install", "--kube-context=staging", "stable/nginx"}, flags)
+
+	if selection.Context != "staging" {
+		t.Error("Incorrect context parsed")
+	}
+}
+
+func TestSelectionParsingStopsAtSeparator(t *testing.T) {
+	flags, _ := executableFlags("kubectl", nil)
+	selection := ParseKubernetesSelection([]string{"exec", "pod", "--", "sh", "--context", "prod"}, flags)
+
+	if selection.Context != "" {
+		t.Error("Parsed arguments after --")
+	}
+}
+
+func TestConfiguredExecutableFlags(t *testing.T) {
+	configured := map[string]configuration.ExecutableFlags{
+		"telepresence": {Context: []string{"--context"}},
+	}
+
+	flags, ok := executableFlags("telepresence", configured)
+	if !ok {
+		t.Fatal("Configured executable flags were not used")
+	}
+
+	selection := ParseKubernetesSelection([]string{"--context", "dev", "--namespace", "test"}, flags)
+	if selection.Context != "dev" {
+		t.Error("Incorrect context parsed")
+	}
+
+	if _, ok := executableFlags("unknown", configured); ok {
+		t.Error("Flags returned for an unknown executable")
+	}
+}
+
+func TestResolveKubernetesSelection(t *testing.T) {
+	config, err := ParseKubeconfig([]byte(exampleMultipleClusterConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context, user := resolveKubernetesSelection(config, KubernetesSelection{})
+	if context.Name != "kubernetes-admin@kubernetes" || user.Name != "kubernetes-admin" {
+		t.Error("Did not select the current context and its user")
+	}
+
+	context, user = resolveKubernetesSelection(config, KubernetesSelection{Context: "kubernetes-admin2@kubernetes2"})
+	if context.Name != "kubernetes-admin2@kubernetes2" || user.Name != "kubernetes-admin2" {
+		t.Error("Did not select the selected context and its user")
+	}
+
+	context, user = resolveKubernetesSelection(config, KubernetesSelection{User: "kubernetes-admin2"})
+	if context.Name != "kubernetes-admin@kubernetes" || user.Name != "kubernetes-admin2" {
+		t.Error("Did not select the selected user")
+	}
+}
+
+func TestRedactArguments(t *testing.T) {
+	arguments := []string{"get", "pods", "--token", "secretToken", "--password=secretPassword", "--pass-credentials", "--context=prod"}
+	redacted := redactArguments(arguments)
+
+	expected := []string{"get", "pods", "--token", "<redacted>", "--password=<redacted>", "--pass-credentials", "--context=prod"}
+	for index := range expected {
+		if redacted[index] != expected[index] {
+			t.Errorf("Argument %d was %q, expected %q", index, redacted[index], expected[index])
+		}
+	}
+
+	if arguments[3] != "secretToken" {
+		t.Error("The arguments passed to the executable were redacted")
+	}
+}
@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultAppRoleMount is the path the AppRole authentication method is mounted at unless configured otherwise
+const DefaultAppRoleMount = "approle"
+
+// AppRoleLogin logs in to Vault using the AppRole authentication method
+type AppRoleLogin struct {
+	Mount    string
+	RoleID   string
+	SecretID string
+}
+
+// Login exchanges the role ID and secret ID for a Vault token
+func (appRoleLogin *AppRoleLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := appRoleLogin.Mount
+	if mount == "" {
+		mount = DefaultAppRoleMount
+	}
+
+	loginPath := fmt.Sprintf("auth/%s/login", mount)
+	payload := map[string]interface{}{
+		"role_id":   appRoleLogin.RoleID,
+		"secret_id": appRoleLogin.SecretID,
+	}
+
+	return loginWithPayload(client, loginPath, payload)
+}
@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAppRoleLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if r.URL.Path != "/v1/auth/ci-approle/login" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if request["role_id"] != "testRoleID" || request["secret_id"] != "testSecretID" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "approle-token"},
+		})
+	}))
+	defer server.Close()
+
+	authenticator := &VaultAuthenticator{Address: server.URL}
+	auth, err := authenticator.Login(&AppRoleLogin{Mount: "ci-approle", RoleID: "testRoleID", SecretID: "testSecretID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.ClientToken != "approle-token" {
+		t.Errorf("Login returned token %q", auth.ClientToken)
+	}
+
+	_, err = authenticator.Login(&AppRoleLogin{Mount: "ci-approle", RoleID: "testRoleID", SecretID: "revoked"})
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrInvalidCredentials {
+		t.Errorf("Rejected secret ID returned %v", err)
+	}
+}
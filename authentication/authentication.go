@@ -1,8 +1,32 @@
 package authentication
 
+import (
+	"github.com/bnmcg/kugo/logging"
+	"github.com/hashicorp/vault/api"
+)
+
 // Authenticator handles authenticating with an external identity provider and retrieving credentials for Kubernetes
 type Authenticator interface {
-	AuthenticateWithUsernamePassword(username string, password string) (KubernetesCredentials, error)
+	Authenticate(loginMethod LoginMethod) (KubernetesCredentials, error)
+}
+
+// LoginMethod exchanges an identity for a Vault token using one of Vault's authentication backends
+type LoginMethod interface {
+	Login(client *api.Client) (*api.SecretAuth, error)
+}
+
+// DeferredLogin creates the login method it wraps only when a login happens, so that secrets are only read, or
+// prompted for, when there's no usable cached token
+type DeferredLogin func() (LoginMethod, error)
+
+// Login creates the wrapped login method and logs in with it
+func (deferredLogin DeferredLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	loginMethod, err := deferredLogin()
+	if err != nil {
+		return nil, err
+	}
+
+	return loginMethod.Login(client)
 }
 
 // KubernetesCredentials represents credentials a user uses to authenticate to a Kubernetes cluster
@@ -10,3 +34,22 @@ type KubernetesCredentials struct {
 	ClientCertificateData string `yaml:"client-certificate-data"`
 	ClientKeyData         string `yaml:"client-key-data"`
 }
+
+func loginWithPayload(client *api.Client, loginPath string, payload map[string]interface{}) (*api.SecretAuth, error) {
+	logging.Debugf("Logging in to Vault at %s", loginPath)
+	secret, err := writeRequest(client, loginPath, payload, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return secretAuth(loginPath, secret)
+}
+
+// secretAuth returns the token from the response to a login
+func secretAuth(loginPath string, secret *api.Secret) (*api.SecretAuth, error) {
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, malformedResponse(loginPath, secret, "the response did not include a token")
+	}
+
+	return secret.Auth, nil
+}
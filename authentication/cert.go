@@ -0,0 +1,34 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultCertMount is the path the TLS certificate authentication method is mounted at unless configured otherwise
+const DefaultCertMount = "cert"
+
+// CertLogin logs in to Vault using the TLS certificate authentication method. The client certificate itself is
+// presented by the connection, so it's configured in VaultAuthenticator.TLS rather than here.
+type CertLogin struct {
+	Mount string
+	// Role names the certificate role to log in with. If it's empty, Vault tries every role which trusts the
+	// certificate.
+	Role string
+}
+
+// Login exchanges the client certificate presented to Vault for a Vault token
+func (certLogin *CertLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := certLogin.Mount
+	if mount == "" {
+		mount = DefaultCertMount
+	}
+
+	payload := map[string]interface{}{}
+	if certLogin.Role != "" {
+		payload["name"] = certLogin.Role
+	}
+
+	return loginWithPayload(client, fmt.Sprintf("auth/%s/login", mount), payload)
+}
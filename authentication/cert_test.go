@@ -0,0 +1,109 @@
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// writeTestClientCertificate writes a self-signed client certificate and its key to the directory
+func writeTestClientCertificate(t *testing.T, directory string, commonName string) (string, string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificateFile := filepath.Join(directory, "client.pem")
+	keyFile := filepath.Join(directory, "client-key.pem")
+	if err := ioutil.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certificateFile, keyFile
+}
+
+func TestCertLogin(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if r.URL.Path != "/v1/auth/cert/login" || len(r.TLS.PeerCertificates) == 0 ||
+			r.TLS.PeerCertificates[0].Subject.CommonName != "jump-host" || request["name"] != "jump-hosts" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid certificate or no client certificate supplied"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "cert-token"},
+		})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	clientCert, clientKey := writeTestClientCertificate(t, directory, "jump-host")
+
+	authenticator := &VaultAuthenticator{
+		Address: server.URL,
+		TLS:     api.TLSConfig{Insecure: true, ClientCert: clientCert, ClientKey: clientKey},
+	}
+
+	auth, err := authenticator.Login(&CertLogin{Role: "jump-hosts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.ClientToken != "cert-token" {
+		t.Errorf("Logged in with token %q", auth.ClientToken)
+	}
+
+	withoutCertificate := &VaultAuthenticator{Address: server.URL, TLS: api.TLSConfig{Insecure: true}}
+	_, err = withoutCertificate.Login(&CertLogin{Role: "jump-hosts"})
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials without a client certificate, got %v", err)
+	}
+}
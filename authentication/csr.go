@@ -0,0 +1,68 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+)
+
+// Key types which may be generated locally when signing a certificate request
+const (
+	KeyTypeRSA2048   = "rsa-2048"
+	KeyTypeRSA4096   = "rsa-4096"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	KeyTypeEd25519   = "ed25519"
+)
+
+// DefaultKeyType is generated when signing is requested without choosing a key type
+const DefaultKeyType = KeyTypeRSA2048
+
+func generatePrivateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+// encodePrivateKey serializes the key as a PEM encoded PKCS#8 block, which Kubernetes clients accept for every key type
+func encodePrivateKey(privateKey crypto.Signer) ([]byte, error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), nil
+}
+
+// createCertificateRequest builds a PEM encoded CSR for the given common name, signed by the private key
+func createCertificateRequest(privateKey crypto.Signer, commonName string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+
+	requestBytes, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: requestBytes}), nil
+}
@@ -0,0 +1,68 @@
+package authentication
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestCertificateRequestForEachKeyType(t *testing.T) {
+	keyTypes := []string{KeyTypeRSA2048, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519}
+	for _, keyType := range keyTypes {
+		privateKey, err := generatePrivateKey(keyType)
+		if err != nil {
+			t.Fatalf("Could not generate %s key: %s", keyType, err)
+		}
+
+		certificateRequestPEM, err := createCertificateRequest(privateKey, "kubernetes-admin")
+		if err != nil {
+			t.Fatalf("Could not create %s certificate request: %s", keyType, err)
+		}
+
+		block, _ := pem.Decode(certificateRequestPEM)
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			t.Fatalf("Certificate request for %s key is not PEM encoded", keyType)
+		}
+
+		certificateRequest, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := certificateRequest.CheckSignature(); err != nil {
+			t.Errorf("Certificate request for %s key has an invalid signature", keyType)
+		}
+
+		if certificateRequest.Subject.CommonName != "kubernetes-admin" {
+			t.Errorf("Certificate request for %s key has the wrong common name", keyType)
+		}
+	}
+}
+
+func TestPrivateKeyEncoding(t *testing.T) {
+	privateKey, err := generatePrivateKey(KeyTypeECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKeyPEM, err := encodePrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatal("Private key is not PEM encoded")
+	}
+
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		t.Error("Could not parse encoded private key")
+	}
+}
+
+func TestUnsupportedKeyType(t *testing.T) {
+	_, err := generatePrivateKey("dsa-1024")
+	if err == nil {
+		t.Error("Did not error on unsupported key type")
+	}
+}
@@ -0,0 +1,146 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Kinds of Vault failure, which VaultError.Kind is set to when a failure is recognised
+var (
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrSealed             = errors.New("vault is sealed")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrMalformedResponse  = errors.New("malformed response")
+)
+
+// VaultError describes a failed Vault request. Kind is one of the Err values above, or nil if the failure wasn't
+// recognised.
+type VaultError struct {
+	Kind       error
+	Path       string
+	StatusCode int
+	RequestID  string
+	Messages   []string
+}
+
+func (vaultError *VaultError) Error() string {
+	message := fmt.Sprintf("vault request to %s failed", vaultError.Path)
+	if vaultError.Kind != nil {
+		message = fmt.Sprintf("%s: %s", message, vaultError.Kind)
+	}
+
+	if vaultError.StatusCode != 0 {
+		message = fmt.Sprintf("%s (status %d)", message, vaultError.StatusCode)
+	}
+
+	if len(vaultError.Messages) > 0 {
+		message = fmt.Sprintf("%s: %s", message, strings.Join(vaultError.Messages, "; "))
+	}
+
+	if vaultError.RequestID != "" {
+		message = fmt.Sprintf("%s [request ID %s]", message, vaultError.RequestID)
+	}
+
+	return message
+}
+
+// Unwrap returns the kind of failure, so that errors.Is(err, ErrPermissionDenied) works
+func (vaultError *VaultError) Unwrap() error {
+	return vaultError.Kind
+}
+
+// malformedResponse reports a successful response which didn't contain what kugo needs
+func malformedResponse(path string, secret *api.Secret, format string, arguments ...interface{}) error {
+	vaultError := &VaultError{
+		Kind:     ErrMalformedResponse,
+		Path:     path,
+		Messages: []string{fmt.Sprintf(format, arguments...)},
+	}
+
+	if secret != nil {
+		vaultError.RequestID = secret.RequestID
+	}
+
+	return vaultError
+}
+
+// writeRequest writes to a Vault path, turning failures into a VaultError. login marks requests to an authentication
+// method, where a rejected request means the credentials were wrong rather than a policy denied access.
+func writeRequest(client *api.Client, path string, payload map[string]interface{}, login bool) (*api.Secret, error) {
+	request := client.NewRequest(http.MethodPut, "/v1/"+path)
+	if err := request.SetJSONBody(payload); err != nil {
+		return nil, err
+	}
+
+	return sendRequest(client, request, path, login)
+}
+
+// readRequest reads a Vault path with the given query parameters, turning failures into a VaultError
+func readRequest(client *api.Client, path string, parameters url.Values, login bool) (*api.Secret, error) {
+	request := client.NewRequest(http.MethodGet, "/v1/"+path)
+	request.Params = parameters
+
+	return sendRequest(client, request, path, login)
+}
+
+func sendRequest(client *api.Client, request *api.Request, path string, login bool) (*api.Secret, error) {
+	response, err := client.RawRequest(request)
+	if response != nil {
+		defer response.Body.Close()
+	}
+
+	if err != nil {
+		if response == nil {
+			return nil, fmt.Errorf("vault request to %s failed: %w", path, err)
+		}
+
+		return nil, responseError(path, response, login)
+	}
+
+	secret, err := api.ParseSecret(response.Body)
+	if err == io.EOF || (err == nil && secret == nil) {
+		return nil, malformedResponse(path, nil, "the response was empty")
+	} else if err != nil {
+		return nil, malformedResponse(path, nil, "the response could not be parsed: %s", err)
+	}
+
+	return secret, nil
+}
+
+// responseError recognises the kind of failure from the status and messages of a failed response
+func responseError(path string, response *api.Response, login bool) error {
+	body := struct {
+		Errors    []string `json:"errors"`
+		RequestID string   `json:"request_id"`
+	}{}
+	json.NewDecoder(response.Body).Decode(&body)
+
+	vaultError := &VaultError{
+		Path:       path,
+		StatusCode: response.StatusCode,
+		RequestID:  body.RequestID,
+		Messages:   body.Errors,
+	}
+
+	messages := strings.ToLower(strings.Join(body.Errors, " "))
+	switch {
+	case response.StatusCode == http.StatusServiceUnavailable && strings.Contains(messages, "sealed"):
+		vaultError.Kind = ErrSealed
+	case login && (response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusForbidden):
+		vaultError.Kind = ErrInvalidCredentials
+	case response.StatusCode == http.StatusForbidden:
+		vaultError.Kind = ErrPermissionDenied
+	case !login && (response.StatusCode == http.StatusNotFound || strings.Contains(messages, "unknown role")):
+		vaultError.Kind = ErrRoleNotFound
+	}
+
+	return vaultError
+}
@@ -0,0 +1,84 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestResponseErrorKinds(t *testing.T) {
+	cases := []struct {
+		statusCode int
+		body       string
+		login      bool
+		expected   error
+	}{
+		{http.StatusForbidden, `{"errors":["1 error occurred:\n\t* permission denied\n\n"]}`, false, ErrPermissionDenied},
+		{http.StatusBadRequest, `{"errors":["unknown role: kugo-pki"]}`, false, ErrRoleNotFound},
+		{http.StatusNotFound, `{"errors":["no handler for route 'pki/issue/kugo-pki'"]}`, false, ErrRoleNotFound},
+		{http.StatusServiceUnavailable, `{"errors":["Vault is sealed"]}`, false, ErrSealed},
+		{http.StatusBadRequest, `{"errors":["invalid username or password"]}`, true, ErrInvalidCredentials},
+		{http.StatusInternalServerError, `{"errors":["internal error"]}`, false, nil},
+	}
+
+	for _, c := range cases {
+		response := &api.Response{Response: &http.Response{
+			StatusCode: c.statusCode,
+			Body:       ioutil.NopCloser(strings.NewReader(c.body)),
+		}}
+
+		err := responseError("pki/issue/kugo-pki", response, c.login)
+		vaultError, ok := err.(*VaultError)
+		if !ok {
+			t.Fatalf("Response error is a %T", err)
+		}
+
+		if vaultError.Kind != c.expected {
+			t.Errorf("Status %d with %s was %v, expected %v", c.statusCode, c.body, vaultError.Kind, c.expected)
+		}
+	}
+}
+
+func TestMalformedResponses(t *testing.T) {
+	responses := map[string]interface{}{
+		"/v1/auth/userpass/login/test": map[string]interface{}{"request_id": "login-request"},
+		"/v1/pki/issue/kugo":           map[string]interface{}{"request_id": "issue-request", "data": map[string]interface{}{"certificate": 1}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if response, ok := responses[r.URL.Path]; ok {
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&UserpassLogin{Username: "test"}).Login(client)
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrMalformedResponse || vaultError.RequestID != "login-request" {
+		t.Errorf("Login without a token returned %v", err)
+	}
+
+	authenticator := &VaultAuthenticator{Address: server.URL, PKIMount: "pki", PKIRole: "kugo"}
+	_, err = authenticator.AuthenticateWithToken("test-token")
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrMalformedResponse || vaultError.RequestID != "issue-request" {
+		t.Errorf("Issuance without a certificate returned %v", err)
+	}
+
+	authenticator.PKIRole = "empty"
+	_, err = authenticator.AuthenticateWithToken("test-token")
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrMalformedResponse {
+		t.Errorf("Empty issuance response returned %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultJWTMount is the path the JWT authentication method is mounted at unless configured otherwise
+const DefaultJWTMount = "jwt"
+
+// JWTLogin logs in to Vault using the JWT authentication method, with a token signed by an identity provider trusted by
+// the role, such as a CI system's job token
+type JWTLogin struct {
+	Mount string
+	Role  string
+	JWT   string
+}
+
+// Login exchanges the JWT for a Vault token
+func (jwtLogin *JWTLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := jwtLogin.Mount
+	if mount == "" {
+		mount = DefaultJWTMount
+	}
+
+	payload := map[string]interface{}{
+		"role": jwtLogin.Role,
+		"jwt":  jwtLogin.JWT,
+	}
+
+	return loginWithPayload(client, fmt.Sprintf("auth/%s/login", mount), payload)
+}
@@ -0,0 +1,40 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWTLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		switch {
+		case r.URL.Path == "/v1/auth/gitlab/login" && request["role"] == "deploy" && request["jwt"] == "ciJobJWT":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "jwt-token"},
+			})
+		case r.URL.Path == "/v1/pki/issue/kugo" && r.Header.Get("X-Vault-Token") == "jwt-token":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"certificate": "testCertificate", "private_key": "testPrivateKey"},
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"error validating token"}})
+		}
+	}))
+	defer server.Close()
+
+	authenticator := &VaultAuthenticator{Address: server.URL, PKIMount: "pki", PKIRole: "kugo"}
+	if _, err := authenticator.Authenticate(&JWTLogin{Mount: "gitlab", Role: "deploy", JWT: "ciJobJWT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := authenticator.Login(&JWTLogin{Mount: "gitlab", Role: "deploy", JWT: "expiredJWT"})
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials for a rejected JWT, got %v", err)
+	}
+}
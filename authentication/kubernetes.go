@@ -0,0 +1,49 @@
+package authentication
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultKubernetesMount is the path the Kubernetes authentication method is mounted at unless configured otherwise
+const DefaultKubernetesMount = "kubernetes"
+
+// DefaultKubernetesTokenPath is where Kubernetes projects the pod's service account token
+const DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// KubernetesLogin logs in to Vault using the Kubernetes authentication method, with the service account token of the
+// pod kugo is running in
+type KubernetesLogin struct {
+	Mount     string
+	Role      string
+	TokenPath string
+}
+
+// Login exchanges the pod's service account token for a Vault token. The token is read on every login, as projected
+// tokens are rotated by the kubelet.
+func (kubernetesLogin *KubernetesLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := kubernetesLogin.Mount
+	if mount == "" {
+		mount = DefaultKubernetesMount
+	}
+
+	tokenPath := kubernetesLogin.TokenPath
+	if tokenPath == "" {
+		tokenPath = DefaultKubernetesTokenPath
+	}
+
+	token, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the service account token: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"role": kubernetesLogin.Role,
+		"jwt":  strings.TrimSpace(string(token)),
+	}
+
+	return loginWithPayload(client, fmt.Sprintf("auth/%s/login", mount), payload)
+}
@@ -0,0 +1,51 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestKubernetesLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if r.URL.Path != "/v1/auth/management/login" || request["role"] != "ci" || request["jwt"] != "serviceAccountJWT" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "kubernetes-token"},
+		})
+	}))
+	defer server.Close()
+
+	tokenFile, err := ioutil.TempFile("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+
+	tokenFile.WriteString("serviceAccountJWT\n")
+	tokenFile.Close()
+
+	authenticator := &VaultAuthenticator{Address: server.URL}
+	auth, err := authenticator.Login(&KubernetesLogin{Mount: "management", Role: "ci", TokenPath: tokenFile.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.ClientToken != "kubernetes-token" {
+		t.Errorf("Logged in with token %q", auth.ClientToken)
+	}
+
+	if _, err := authenticator.Login(&KubernetesLogin{Role: "ci", TokenPath: tokenFile.Name() + ".missing"}); err == nil {
+		t.Error("Did not error on a missing service account token")
+	}
+}
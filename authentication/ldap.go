@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultLDAPMount is the path the LDAP authentication method is mounted at unless configured otherwise
+const DefaultLDAPMount = "ldap"
+
+// LDAPLogin logs in to Vault using the LDAP authentication method, so that the directory's groups decide the token's
+// policies
+type LDAPLogin struct {
+	Mount    string
+	Username string
+	Password string
+}
+
+// Login exchanges the directory username and password for a Vault token
+func (ldapLogin *LDAPLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := ldapLogin.Mount
+	if mount == "" {
+		mount = DefaultLDAPMount
+	}
+
+	loginPath := fmt.Sprintf("auth/%s/login/%s", mount, ldapLogin.Username)
+	payload := map[string]interface{}{
+		"password": ldapLogin.Password,
+	}
+
+	return loginWithPayload(client, loginPath, payload)
+}
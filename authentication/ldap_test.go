@@ -0,0 +1,60 @@
+package authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bnmcg/kugo/logging"
+)
+
+func TestLDAPLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if r.URL.Path != "/v1/auth/corp-ldap/login/jdoe" || request["password"] != "directoryPassword" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"ldap operation failed"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   "ldap-token",
+				"policies":       []string{"default", "kubernetes-admins"},
+				"token_policies": []string{"default", "kubernetes-admins"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	output := &bytes.Buffer{}
+	logging.SetOutput(output)
+	logging.SetLevel(logging.LevelDebug)
+	defer logging.SetOutput(os.Stderr)
+	defer logging.SetLevel(logging.LevelInfo)
+
+	authenticator := &VaultAuthenticator{Address: server.URL}
+	auth, err := authenticator.Login(&LDAPLogin{Mount: "corp-ldap", Username: "jdoe", Password: "directoryPassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.ClientToken != "ldap-token" {
+		t.Errorf("Login returned token %q", auth.ClientToken)
+	}
+
+	if !strings.Contains(output.String(), "policies [default, kubernetes-admins]") {
+		t.Errorf("Token policies were not shown in debug output: %s", output.String())
+	}
+
+	_, err = authenticator.Login(&LDAPLogin{Mount: "corp-ldap", Username: "jdoe", Password: "wrong"})
+	if vaultError, ok := err.(*VaultError); !ok || vaultError.Kind != ErrInvalidCredentials {
+		t.Errorf("Wrong password returned %v", err)
+	}
+}
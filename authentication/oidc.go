@@ -0,0 +1,254 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/bnmcg/kugo/logging"
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultOIDCMount is the path the OIDC authentication method is mounted at unless configured otherwise
+const DefaultOIDCMount = "oidc"
+
+// DefaultOIDCListenAddress is where the callback listener waits for the browser, matching `vault login -method=oidc`
+const DefaultOIDCListenAddress = "localhost:8250"
+
+// DefaultOIDCTimeout is how long to wait for the browser login to complete
+const DefaultOIDCTimeout = 5 * time.Minute
+
+// oidcCallbackPath is the path of the redirect URI, which must be allowed by the Vault role
+const oidcCallbackPath = "/oidc/callback"
+
+// OIDCLogin logs in to Vault through an OIDC provider in the browser. A listener on localhost receives the provider's
+// redirect, and the code it carries is exchanged for a Vault token.
+type OIDCLogin struct {
+	Mount         string
+	Role          string
+	ListenAddress string
+	Timeout       time.Duration
+
+	// SkipBrowser only prints the login URL, rather than also opening it in the browser
+	SkipBrowser bool
+	// OpenURL opens the login URL, defaulting to the system's browser
+	OpenURL func(loginURL string) error
+	// Output receives the login instructions, defaulting to stderr
+	Output io.Writer
+}
+
+// oidcCallback is the result of the provider's redirect to the callback listener
+type oidcCallback struct {
+	code  string
+	state string
+	err   error
+}
+
+// Login opens the provider's login page and waits for it to redirect back with a code to exchange for a Vault token
+func (oidcLogin *OIDCLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := oidcLogin.Mount
+	if mount == "" {
+		mount = DefaultOIDCMount
+	}
+
+	listenAddress := oidcLogin.ListenAddress
+	if listenAddress == "" {
+		listenAddress = DefaultOIDCListenAddress
+	}
+
+	timeout := oidcLogin.Timeout
+	if timeout == 0 {
+		timeout = DefaultOIDCTimeout
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("could not start the OIDC callback listener on %s: %w", listenAddress, err)
+	}
+	defer listener.Close()
+
+	redirectURI, err := oidcRedirectURI(listenAddress, listener.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := oidcNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	authURLPath := fmt.Sprintf("auth/%s/oidc/auth_url", mount)
+	logging.Debugf("Requesting an OIDC login URL from %s with redirect URI %s", authURLPath, redirectURI)
+	secret, err := writeRequest(client, authURLPath, map[string]interface{}{
+		"role":         oidcLogin.Role,
+		"redirect_uri": redirectURI,
+		"client_nonce": nonce,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := secretString(authURLPath, secret, "auth_url")
+	if err != nil {
+		return nil, fmt.Errorf("%w, check that the role allows the redirect URI %s", err, redirectURI)
+	}
+
+	// Only the redirect for this login carries the state Vault put in the login URL
+	state, err := oidcState(authURLPath, secret, authURL)
+	if err != nil {
+		return nil, err
+	}
+
+	callbacks := make(chan oidcCallback, 1)
+	server := &http.Server{Handler: oidcCallbackHandler(state, callbacks)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	oidcLogin.openLoginURL(authURL)
+
+	select {
+	case callback := <-callbacks:
+		if callback.err != nil {
+			return nil, callback.err
+		}
+
+		return loginWithCallback(client, fmt.Sprintf("auth/%s/oidc/callback", mount), url.Values{
+			"code":         {callback.code},
+			"state":        {callback.state},
+			"client_nonce": {nonce},
+		})
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out after %s waiting for the OIDC login to complete", timeout)
+	}
+}
+
+// openLoginURL shows the login URL, and opens it unless the browser is skipped. A failure to open the browser isn't
+// fatal, as the URL may still be opened by hand.
+func (oidcLogin *OIDCLogin) openLoginURL(authURL string) {
+	output := oidcLogin.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if oidcLogin.SkipBrowser {
+		fmt.Fprintf(output, "Complete the login with your OIDC provider by opening:\n\n    %s\n\n", authURL)
+		return
+	}
+
+	fmt.Fprintf(output, "Complete the login with your OIDC provider. Opening the browser to:\n\n    %s\n\n", authURL)
+
+	openURL := oidcLogin.OpenURL
+	if openURL == nil {
+		openURL = openBrowser
+	}
+
+	if err := openURL(authURL); err != nil {
+		fmt.Fprintf(output, "Could not open the browser (%s), open the URL above by hand.\n", err)
+	}
+}
+
+// oidcCallbackHandler passes the code and state of the provider's redirect on to the login. Requests without the
+// login's state weren't sent by the provider for this login, so they're rejected without ending the login.
+func oidcCallbackHandler(state string, callbacks chan<- oidcCallback) http.Handler {
+	handler := http.NewServeMux()
+	handler.HandleFunc(oidcCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<html><body>kugo login failed: the state does not match this login</body></html>")
+			return
+		}
+
+		callback := oidcCallback{code: query.Get("code"), state: query.Get("state")}
+		if providerError := query.Get("error"); providerError != "" {
+			callback.err = fmt.Errorf("OIDC provider returned an error: %s %s", providerError, query.Get("error_description"))
+		} else if callback.code == "" {
+			callback.err = errors.New("OIDC provider did not return a code")
+		}
+
+		if callback.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<html><body>kugo login failed: %s</body></html>", callback.err)
+		} else {
+			fmt.Fprint(w, "<html><body>kugo login succeeded, you may close this window.</body></html>")
+		}
+
+		select {
+		case callbacks <- callback:
+		default:
+		}
+	})
+
+	return handler
+}
+
+func loginWithCallback(client *api.Client, callbackPath string, parameters url.Values) (*api.SecretAuth, error) {
+	logging.Debugf("Exchanging the OIDC code at %s", callbackPath)
+	secret, err := readRequest(client, callbackPath, parameters, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return secretAuth(callbackPath, secret)
+}
+
+// oidcRedirectURI builds the redirect URI from the configured host and the port actually listened on, so that port 0
+// may be used to pick any free port
+func oidcRedirectURI(listenAddress string, listenerAddress net.Addr) (string, error) {
+	host, _, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return "", fmt.Errorf("invalid OIDC listen address %s: %w", listenAddress, err)
+	}
+
+	_, port, err := net.SplitHostPort(listenerAddress.String())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), oidcCallbackPath), nil
+}
+
+// oidcState returns the state Vault put in the login URL, which the provider passes back in its redirect
+func oidcState(authURLPath string, secret *api.Secret, authURL string) (string, error) {
+	parsedURL, err := url.Parse(authURL)
+	if err != nil {
+		return "", malformedResponse(authURLPath, secret, "the auth_url could not be parsed: %s", err)
+	}
+
+	state := parsedURL.Query().Get("state")
+	if state == "" {
+		return "", malformedResponse(authURLPath, secret, "the auth_url did not include a state")
+	}
+
+	return state, nil
+}
+
+func oidcNonce() (string, error) {
+	nonce := make([]byte, 20)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// openBrowser opens the URL in the system's default browser
+func openBrowser(loginURL string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", loginURL).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", loginURL).Start()
+	}
+
+	return exec.Command("xdg-open", loginURL).Start()
+}
@@ -0,0 +1,157 @@
+package authentication
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestOIDCProvider redirects every login straight back to the redirect URI, as if the user had signed in
+func newTestOIDCProvider(providerError string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		callback := url.Values{"state": {query.Get("state")}}
+		if providerError != "" {
+			callback.Set("error", providerError)
+		} else {
+			callback.Set("code", "testCode")
+		}
+
+		http.Redirect(w, r, query.Get("redirect_uri")+"?"+callback.Encode(), http.StatusFound)
+	}))
+}
+
+func newTestOIDCVault(t *testing.T, provider *httptest.Server) *httptest.Server {
+	var nonce, redirectURI string
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/oidc/oidc/auth_url":
+			payload := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			if payload["role"] != "developer" || payload["client_nonce"] == "" {
+				t.Errorf("Unexpected auth URL request %v", payload)
+			}
+
+			nonce, redirectURI = payload["client_nonce"], payload["redirect_uri"]
+			authURL := provider.URL + "/authorize?" + url.Values{"state": {"testState"}, "redirect_uri": {redirectURI}}.Encode()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"auth_url": authURL},
+			})
+		case "/v1/auth/oidc/oidc/callback":
+			query := r.URL.Query()
+			if query.Get("code") != "testCode" || query.Get("state") != "testState" || query.Get("client_nonce") != nonce {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid code or state"}})
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "oidc-token"},
+			})
+		case "/v1/pki/issue/kugo":
+			if r.Header.Get("X-Vault-Token") != "oidc-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"certificate": "testCertificate", "private_key": "testPrivateKey"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// newTestOIDCLogin follows the login URL in the background, in place of the user's browser
+func newTestOIDCLogin(output *bytes.Buffer) *OIDCLogin {
+	return &OIDCLogin{
+		Role:          "developer",
+		ListenAddress: "127.0.0.1:0",
+		Timeout:       10 * time.Second,
+		OpenURL: func(loginURL string) error {
+			go http.Get(loginURL)
+			return nil
+		},
+		Output: output,
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newTestOIDCProvider("")
+	defer provider.Close()
+
+	vault := newTestOIDCVault(t, provider)
+	defer vault.Close()
+
+	output := &bytes.Buffer{}
+	oidcLogin := newTestOIDCLogin(output)
+	oidcLogin.OpenURL = func(loginURL string) error {
+		// A request with another login's state must not end this one
+		response, err := http.Get(strings.Replace(loginURL, provider.URL+"/authorize?", provider.URL+"/authorize?state=otherState&", 1))
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Callback with another state returned status %d", response.StatusCode)
+		}
+
+		go http.Get(loginURL)
+		return nil
+	}
+
+	authenticator := &VaultAuthenticator{Address: vault.URL, PKIMount: "pki", PKIRole: "kugo"}
+	credentials, err := authenticator.Authenticate(oidcLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if credentials.ClientCertificateData != base64.StdEncoding.EncodeToString([]byte("testCertificate")) {
+		t.Errorf("Issued certificate %q", credentials.ClientCertificateData)
+	}
+
+	if !strings.Contains(output.String(), provider.URL+"/authorize") {
+		t.Errorf("Login URL was not shown: %q", output.String())
+	}
+}
+
+func TestOIDCLoginProviderError(t *testing.T) {
+	provider := newTestOIDCProvider("access_denied")
+	defer provider.Close()
+
+	vault := newTestOIDCVault(t, provider)
+	defer vault.Close()
+
+	authenticator := &VaultAuthenticator{Address: vault.URL}
+	_, err := authenticator.Login(newTestOIDCLogin(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+}
+
+func TestOIDCLoginTimeout(t *testing.T) {
+	provider := newTestOIDCProvider("")
+	defer provider.Close()
+
+	vault := newTestOIDCVault(t, provider)
+	defer vault.Close()
+
+	oidcLogin := newTestOIDCLogin(&bytes.Buffer{})
+	oidcLogin.Timeout = 100 * time.Millisecond
+	oidcLogin.SkipBrowser = true
+
+	authenticator := &VaultAuthenticator{Address: vault.URL}
+	if _, err := authenticator.Login(oidcLogin); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
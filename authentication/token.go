@@ -0,0 +1,21 @@
+package authentication
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// TokenLogin uses an existing Vault token, such as one created by `vault login`
+type TokenLogin struct {
+	Token string
+}
+
+// Login returns the configured token without contacting Vault
+func (tokenLogin *TokenLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	if tokenLogin.Token == "" {
+		return nil, errors.New("no Vault token configured")
+	}
+
+	return &api.SecretAuth{ClientToken: tokenLogin.Token}, nil
+}
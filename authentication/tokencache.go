@@ -0,0 +1,107 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// TokenCache keeps Vault tokens between invocations, so that kugo doesn't log in every time it issues a certificate.
+// Tokens are keyed by Vault address, namespace and identity and stored in files only readable by their owner.
+type TokenCache struct {
+	Directory string
+	// Identity describes the login the tokens come from, such as the auth method, mount and username, so that logins
+	// with different identities on the same Vault never share a token
+	Identity string
+}
+
+type cachedToken struct {
+	Address   string `json:"address"`
+	Namespace string `json:"namespace,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+	Token     string `json:"token"`
+}
+
+// DefaultTokenCacheDirectory returns $XDG_CACHE_HOME/kugo, or $HOME/.cache/kugo when XDG_CACHE_HOME isn't set
+func DefaultTokenCacheDirectory() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		cacheHome = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+
+	return filepath.Join(cacheHome, "kugo")
+}
+
+func (tokenCache *TokenCache) path(address string, namespace string) string {
+	key := sha256.Sum256([]byte(address + "\n" + namespace + "\n" + tokenCache.Identity))
+	return filepath.Join(tokenCache.Directory, "vault-token-"+hex.EncodeToString(key[:8])+".json")
+}
+
+// Load returns the cached token for the Vault address, namespace and the cache's identity, or an empty string if there
+// isn't one
+func (tokenCache *TokenCache) Load(address string, namespace string) (string, error) {
+	tokenBytes, err := ioutil.ReadFile(tokenCache.path(address, namespace))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	token := cachedToken{}
+	if err := json.Unmarshal(tokenBytes, &token); err != nil {
+		return "", err
+	}
+
+	if token.Address != address || token.Namespace != namespace || token.Identity != tokenCache.Identity {
+		return "", nil
+	}
+
+	return token.Token, nil
+}
+
+// Store saves the token for the Vault address, namespace and the cache's identity
+func (tokenCache *TokenCache) Store(address string, namespace string, token string) error {
+	if err := os.MkdirAll(tokenCache.Directory, 0700); err != nil {
+		return err
+	}
+
+	tokenBytes, err := json.Marshal(cachedToken{Address: address, Namespace: namespace, Identity: tokenCache.Identity, Token: token})
+	if err != nil {
+		return err
+	}
+
+	temporaryFile, err := ioutil.TempFile(tokenCache.Directory, ".vault-token-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	if err := temporaryFile.Chmod(0600); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+
+	if _, err := temporaryFile.Write(tokenBytes); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryFile.Name(), tokenCache.path(address, namespace))
+}
+
+// Remove deletes the cached token for the Vault address, namespace and the cache's identity, if there is one
+func (tokenCache *TokenCache) Remove(address string, namespace string) error {
+	err := os.Remove(tokenCache.path(address, namespace))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testTokenCache(t *testing.T) *TokenCache {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &TokenCache{Directory: filepath.Join(directory, "kugo")}
+}
+
+func TestTokenCache(t *testing.T) {
+	tokenCache := testTokenCache(t)
+	defer os.RemoveAll(filepath.Dir(tokenCache.Directory))
+
+	if token, err := tokenCache.Load("https://vault:8200", ""); err != nil || token != "" {
+		t.Error("Empty cache returned a token")
+	}
+
+	if err := tokenCache.Store("https://vault:8200", "", "root-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tokenCache.Store("https://vault:8200", "team", "team-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, _ := tokenCache.Load("https://vault:8200", ""); token != "root-token" {
+		t.Errorf("Loaded %q for the root namespace", token)
+	}
+
+	if token, _ := tokenCache.Load("https://vault:8200", "team"); token != "team-token" {
+		t.Errorf("Loaded %q for the team namespace", token)
+	}
+
+	info, err := os.Stat(tokenCache.path("https://vault:8200", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Cached token has mode %s", info.Mode().Perm())
+	}
+
+	if err := tokenCache.Remove("https://vault:8200", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, _ := tokenCache.Load("https://vault:8200", ""); token != "" {
+		t.Error("Removed token was still cached")
+	}
+}
+
+func TestTokenCacheIdentities(t *testing.T) {
+	tokenCache := testTokenCache(t)
+	defer os.RemoveAll(filepath.Dir(tokenCache.Directory))
+
+	alice := &TokenCache{Directory: tokenCache.Directory, Identity: "userpass userpass alice"}
+	bob := &TokenCache{Directory: tokenCache.Directory, Identity: "userpass userpass bob"}
+
+	if err := alice.Store("https://vault:8200", "", "alice-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, _ := bob.Load("https://vault:8200", ""); token != "" {
+		t.Errorf("Loaded %q for a different identity", token)
+	}
+
+	if token, _ := alice.Load("https://vault:8200", ""); token != "alice-token" {
+		t.Errorf("Loaded %q for the same identity", token)
+	}
+}
+
+func TestVaultAuthenticatorReusesCachedToken(t *testing.T) {
+	logins, renewals, revocations := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/userpass/login/test":
+			logins++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "cached-token", "renewable": true, "lease_duration": 3600},
+			})
+		case "/v1/auth/token/lookup-self":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"id": "cached-token", "renewable": true, "ttl": 60},
+			})
+		case "/v1/auth/token/renew-self":
+			renewals++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "cached-token", "renewable": true, "lease_duration": 3600},
+			})
+		case "/v1/auth/token/revoke-self":
+			revocations++
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tokenCache := testTokenCache(t)
+	defer os.RemoveAll(filepath.Dir(tokenCache.Directory))
+
+	authenticator := &VaultAuthenticator{Address: server.URL, TokenCache: tokenCache}
+	loginMethod := &UserpassLogin{Username: "test", Password: "test"}
+
+	for i := 0; i < 2; i++ {
+		auth, err := authenticator.Login(loginMethod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if auth.ClientToken != "cached-token" {
+			t.Errorf("Login returned token %q", auth.ClientToken)
+		}
+	}
+
+	if logins != 1 || renewals != 1 {
+		t.Errorf("Expected 1 login and 1 renewal, got %d and %d", logins, renewals)
+	}
+
+	if err := authenticator.Logout(); err != nil {
+		t.Fatal(err)
+	}
+
+	if revocations != 1 {
+		t.Error("Logout did not revoke the cached token")
+	}
+
+	if token, _ := tokenCache.Load(server.URL, ""); token != "" {
+		t.Error("Logout did not remove the cached token")
+	}
+}
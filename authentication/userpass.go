@@ -0,0 +1,32 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultUserpassMount is the path the username/password authentication method is mounted at unless configured otherwise
+const DefaultUserpassMount = "userpass"
+
+// UserpassLogin logs in to Vault using the username/password authentication method
+type UserpassLogin struct {
+	Mount    string
+	Username string
+	Password string
+}
+
+// Login exchanges the username and password for a Vault token
+func (userpassLogin *UserpassLogin) Login(client *api.Client) (*api.SecretAuth, error) {
+	mount := userpassLogin.Mount
+	if mount == "" {
+		mount = DefaultUserpassMount
+	}
+
+	loginPath := fmt.Sprintf("auth/%s/login/%s", mount, userpassLogin.Username)
+	payload := map[string]interface{}{
+		"password": userpassLogin.Password,
+	}
+
+	return loginWithPayload(client, loginPath, payload)
+}
@@ -3,35 +3,272 @@ package authentication
 import (
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/bnmcg/kugo/logging"
 	"github.com/hashicorp/vault/api"
 )
 
-// VaultAuthenticator retrieves Kubernetes credentials from Hashicorp Vault
+// PKI modes which control where the private key for a Kubernetes certificate is generated
+const (
+	// PKIModeIssue has Vault generate the private key and return it alongside the certificate
+	PKIModeIssue = "issue"
+	// PKIModeSign generates the private key locally and only sends a certificate request to Vault
+	PKIModeSign = "sign"
+)
+
+// minimumCachedTokenTTL is the least time a cached token must have left to be used instead of logging in again
+const minimumCachedTokenTTL = time.Minute
+
+// namespaceHeader is the header the Vault client uses to select a Vault Enterprise namespace
+const namespaceHeader = "X-Vault-Namespace"
+
+// insecureWarnings records the Vault addresses which have been warned about disabled certificate verification, so that
+// the warning is shown once per address
+var insecureWarnings sync.Map
+
+// VaultAuthenticator retrieves Kubernetes credentials from Hashicorp Vault. Settings which aren't given fall back to
+// the environment variables used by the Vault CLI, such as VAULT_ADDR and VAULT_CACERT.
 type VaultAuthenticator struct {
-	Address            string
+	Address string
+	TLS     api.TLSConfig
+
+	// AuthNamespace and PKINamespace are the Vault Enterprise namespaces to log in and issue certificates in. They
+	// may differ, such as when users log in at the root namespace and issue certificates in a child namespace.
+	AuthNamespace string
+	PKINamespace  string
+
 	PKIMount           string
 	PKIRole            string
+	PKIMode            string
+	KeyType            string
 	KubernetesUsername string
 	KubernetesTTL      string
+
+	// TokenCache keeps the Vault token between invocations when set
+	TokenCache *TokenCache
 }
 
-// AuthenticateWithUsernamePassword retrieves credentials from Hashicorp Vault using the username/password authentication method
-func (vaultAuthenticator *VaultAuthenticator) AuthenticateWithUsernamePassword(username string, password string) (KubernetesCredentials, error) {
-	client, err := api.NewClient(&api.Config{
-		Address: vaultAuthenticator.Address,
-	})
+// Authenticate logs in to Hashicorp Vault using the given login method and issues Kubernetes credentials from the PKI role
+func (vaultAuthenticator *VaultAuthenticator) Authenticate(loginMethod LoginMethod) (KubernetesCredentials, error) {
+	client, err := vaultAuthenticator.newClient(vaultAuthenticator.AuthNamespace)
 	if err != nil {
 		return KubernetesCredentials{}, err
 	}
 
-	token, err := exchangeUsernamePasswordForVaultToken(username, password, client)
+	auth, err := vaultAuthenticator.login(client, loginMethod)
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
+
+	return vaultAuthenticator.AuthenticateWithToken(auth.ClientToken)
+}
+
+// AuthenticateWithToken issues Kubernetes credentials from the PKI role using a Vault token from an earlier login, so
+// that one login may be shared by many issuances
+func (vaultAuthenticator *VaultAuthenticator) AuthenticateWithToken(token string) (KubernetesCredentials, error) {
+	client, err := vaultAuthenticator.newClient(vaultAuthenticator.PKINamespace)
 	if err != nil {
 		return KubernetesCredentials{}, err
 	}
 
 	client.SetToken(token)
+	return vaultAuthenticator.requestCertificate(client)
+}
+
+// Login logs in to Hashicorp Vault using the given login method without issuing any credentials
+func (vaultAuthenticator *VaultAuthenticator) Login(loginMethod LoginMethod) (*api.SecretAuth, error) {
+	client, err := vaultAuthenticator.newClient(vaultAuthenticator.AuthNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return vaultAuthenticator.login(client, loginMethod)
+}
+
+// newClient creates a Vault client for the namespace. When no namespace is given, VAULT_NAMESPACE is used if it's set.
+func (vaultAuthenticator *VaultAuthenticator) newClient(namespace string) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	if vaultAuthenticator.Address != "" {
+		config.Address = vaultAuthenticator.Address
+	}
 
+	if vaultAuthenticator.TLS != (api.TLSConfig{}) {
+		if err := config.ConfigureTLS(&vaultAuthenticator.TLS); err != nil {
+			return nil, fmt.Errorf("invalid Vault TLS configuration: %w", err)
+		}
+	}
+
+	transport, ok := config.HttpClient.Transport.(*http.Transport)
+	if ok && transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify {
+		if _, warned := insecureWarnings.LoadOrStore(config.Address, true); !warned {
+			logging.Warnf("TLS certificate verification is disabled for Vault at %s. Anyone able to intercept the connection can steal your Vault credentials and Kubernetes certificates.", config.Address)
+		}
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
+	return client, nil
+}
+
+// Logout revokes the cached Vault token, if there is one, and removes it from the cache
+func (vaultAuthenticator *VaultAuthenticator) Logout() error {
+	if vaultAuthenticator.TokenCache == nil {
+		return nil
+	}
+
+	client, err := vaultAuthenticator.newClient(vaultAuthenticator.AuthNamespace)
+	if err != nil {
+		return err
+	}
+
+	namespace := client.Headers().Get(namespaceHeader)
+	token, err := vaultAuthenticator.TokenCache.Load(client.Address(), namespace)
+	if err != nil || token == "" {
+		return err
+	}
+
+	client.SetToken(token)
+	if err := client.Auth().Token().RevokeSelf(""); err != nil {
+		logging.Debugf("Could not revoke the cached Vault token: %s", err)
+	} else {
+		logging.Debugf("Revoked the cached Vault token")
+	}
+
+	return vaultAuthenticator.TokenCache.Remove(client.Address(), namespace)
+}
+
+func (vaultAuthenticator *VaultAuthenticator) login(client *api.Client, loginMethod LoginMethod) (*api.SecretAuth, error) {
+	useCache := vaultAuthenticator.TokenCache != nil
+
+	if useCache {
+		if auth := vaultAuthenticator.cachedLogin(client); auth != nil {
+			logPolicies(auth)
+			return auth, nil
+		}
+	}
+
+	logging.Debugf("Authenticating to Vault at %s", client.Address())
+	auth, err := loginMethod.Login(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if useCache && auth != nil && auth.ClientToken != "" {
+		err = vaultAuthenticator.TokenCache.Store(client.Address(), client.Headers().Get(namespaceHeader), auth.ClientToken)
+		if err != nil {
+			logging.Debugf("Could not cache the Vault token: %s", err)
+		}
+	}
+
+	logPolicies(auth)
+	return auth, nil
+}
+
+// logPolicies shows which policies the token was granted, so that users can tell why a PKI request was denied. Policies
+// granted through groups, such as LDAP groups, appear in the token's or identity's policies.
+func logPolicies(auth *api.SecretAuth) {
+	if auth == nil {
+		return
+	}
+
+	logging.Debugf("Vault token has policies [%s]", strings.Join(auth.Policies, ", "))
+	if len(auth.TokenPolicies) > 0 || len(auth.IdentityPolicies) > 0 {
+		logging.Debugf("Token policies [%s], identity policies [%s]", strings.Join(auth.TokenPolicies, ", "), strings.Join(auth.IdentityPolicies, ", "))
+	}
+}
+
+// cachedLogin looks up the cached token and renews it if possible. It returns nil if there's no usable cached token,
+// in which case a fresh login is needed.
+func (vaultAuthenticator *VaultAuthenticator) cachedLogin(client *api.Client) *api.SecretAuth {
+	namespace := client.Headers().Get(namespaceHeader)
+	token, err := vaultAuthenticator.TokenCache.Load(client.Address(), namespace)
+	if err != nil {
+		logging.Debugf("Could not read the cached Vault token: %s", err)
+		return nil
+	}
+
+	if token == "" {
+		return nil
+	}
+
+	client.SetToken(token)
+	defer client.ClearToken()
+
+	discard := func(reason string, err error) *api.SecretAuth {
+		logging.Debugf("Not using the cached Vault token, %s: %v", reason, err)
+		if err := vaultAuthenticator.TokenCache.Remove(client.Address(), namespace); err != nil {
+			logging.Debugf("Could not remove the cached Vault token: %s", err)
+		}
+
+		return nil
+	}
+
+	secret, err := client.Auth().Token().LookupSelf()
+	if err != nil || secret == nil {
+		return discard("lookup failed", err)
+	}
+
+	renewable, _ := secret.TokenIsRenewable()
+	if renewable {
+		renewed, err := client.Auth().Token().RenewSelf(0)
+		if err != nil || renewed == nil || renewed.Auth == nil {
+			return discard("renewal failed", err)
+		}
+
+		if time.Duration(renewed.Auth.LeaseDuration)*time.Second < minimumCachedTokenTTL {
+			return discard("it has reached its maximum TTL", nil)
+		}
+
+		if renewed.Auth.ClientToken == "" {
+			renewed.Auth.ClientToken = token
+		}
+
+		logging.Debugf("Renewed the cached Vault token for %ds", renewed.Auth.LeaseDuration)
+		return renewed.Auth
+	}
+
+	// Tokens without a TTL never expire
+	ttl, _ := secret.TokenTTL()
+	if ttl != 0 && ttl < minimumCachedTokenTTL {
+		return discard("it is about to expire", nil)
+	}
+
+	policies, _ := secret.TokenPolicies()
+	logging.Debugf("Using the cached Vault token, valid for %s", ttl)
+	return &api.SecretAuth{
+		ClientToken:   token,
+		Policies:      policies,
+		LeaseDuration: int(ttl.Seconds()),
+	}
+}
+
+func (vaultAuthenticator *VaultAuthenticator) requestCertificate(client *api.Client) (KubernetesCredentials, error) {
+	switch vaultAuthenticator.PKIMode {
+	case "", PKIModeIssue:
+		return vaultAuthenticator.issueCertificate(client)
+	case PKIModeSign:
+		return vaultAuthenticator.signCertificate(client)
+	}
+
+	return KubernetesCredentials{}, fmt.Errorf("unsupported PKI mode %q", vaultAuthenticator.PKIMode)
+}
+
+func (vaultAuthenticator *VaultAuthenticator) issueCertificate(client *api.Client) (KubernetesCredentials, error) {
 	certificateRequestPayload := map[string]interface{}{
 		"common_name": vaultAuthenticator.KubernetesUsername,
 		"ttl":         vaultAuthenticator.KubernetesTTL,
@@ -39,13 +276,21 @@ func (vaultAuthenticator *VaultAuthenticator) AuthenticateWithUsernamePassword(u
 
 	certificateRequestPath := fmt.Sprintf("%s/issue/%s", vaultAuthenticator.PKIMount, vaultAuthenticator.PKIRole)
 
-	certificateSecret, err := client.Logical().Write(certificateRequestPath, certificateRequestPayload)
+	logging.Debugf("Requesting certificate for %q from %s", vaultAuthenticator.KubernetesUsername, certificateRequestPath)
+	certificateSecret, err := writeRequest(client, certificateRequestPath, certificateRequestPayload, false)
 	if err != nil {
 		return KubernetesCredentials{}, err
 	}
 
-	PEMCertificateAsString := certificateSecret.Data["certificate"].(string)
-	RSAPrivateKeyAsString := certificateSecret.Data["private_key"].(string)
+	PEMCertificateAsString, err := secretString(certificateRequestPath, certificateSecret, "certificate")
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
+
+	RSAPrivateKeyAsString, err := secretString(certificateRequestPath, certificateSecret, "private_key")
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
 
 	return KubernetesCredentials{
 		ClientCertificateData: base64.StdEncoding.EncodeToString([]byte(PEMCertificateAsString)),
@@ -53,16 +298,58 @@ func (vaultAuthenticator *VaultAuthenticator) AuthenticateWithUsernamePassword(u
 	}, nil
 }
 
-func exchangeUsernamePasswordForVaultToken(username string, password string, api *api.Client) (string, error) {
-	loginPath := fmt.Sprintf("auth/userpass/login/%s", username)
-	payload := map[string]interface{}{
-		"password": password,
+func (vaultAuthenticator *VaultAuthenticator) signCertificate(client *api.Client) (KubernetesCredentials, error) {
+	keyType := vaultAuthenticator.KeyType
+	if keyType == "" {
+		keyType = DefaultKeyType
+	}
+
+	privateKey, err := generatePrivateKey(keyType)
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
+
+	certificateRequest, err := createCertificateRequest(privateKey, vaultAuthenticator.KubernetesUsername)
+	if err != nil {
+		return KubernetesCredentials{}, err
 	}
 
-	secret, err := api.Logical().Write(loginPath, payload)
+	privateKeyPEM, err := encodePrivateKey(privateKey)
 	if err != nil {
-		return "", err
+		return KubernetesCredentials{}, err
+	}
+
+	certificateRequestPayload := map[string]interface{}{
+		"csr":         string(certificateRequest),
+		"common_name": vaultAuthenticator.KubernetesUsername,
+		"ttl":         vaultAuthenticator.KubernetesTTL,
+	}
+
+	certificateRequestPath := fmt.Sprintf("%s/sign/%s", vaultAuthenticator.PKIMount, vaultAuthenticator.PKIRole)
+
+	logging.Debugf("Requesting certificate for %q from %s", vaultAuthenticator.KubernetesUsername, certificateRequestPath)
+	certificateSecret, err := writeRequest(client, certificateRequestPath, certificateRequestPayload, false)
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
+
+	PEMCertificateAsString, err := secretString(certificateRequestPath, certificateSecret, "certificate")
+	if err != nil {
+		return KubernetesCredentials{}, err
+	}
+
+	return KubernetesCredentials{
+		ClientCertificateData: base64.StdEncoding.EncodeToString([]byte(PEMCertificateAsString)),
+		ClientKeyData:         base64.StdEncoding.EncodeToString(privateKeyPEM),
+	}, nil
+}
+
+// secretString reads a non-empty string field from the data of a Vault response
+func secretString(path string, secret *api.Secret, field string) (string, error) {
+	value, ok := secret.Data[field].(string)
+	if !ok || value == "" {
+		return "", malformedResponse(path, secret, "the response did not include %s", field)
 	}
 
-	return secret.Auth.ClientToken, nil
+	return value, nil
 }
@@ -0,0 +1,120 @@
+package authentication
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func newTestTLSVault(t *testing.T) (*httptest.Server, string) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "test-token"},
+		})
+	}))
+
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCertificate := filepath.Join(directory, "ca.pem")
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caCertificate, certificatePEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, caCertificate
+}
+
+func TestVaultTLSConfiguration(t *testing.T) {
+	server, caCertificate := newTestTLSVault(t)
+	defer server.Close()
+	defer os.RemoveAll(filepath.Dir(caCertificate))
+
+	loginMethod := &UserpassLogin{Username: "test", Password: "test"}
+
+	untrusted := &VaultAuthenticator{Address: server.URL}
+	if _, err := untrusted.Login(loginMethod); err == nil {
+		t.Error("Logged in to Vault with an untrusted certificate")
+	}
+
+	trusted := &VaultAuthenticator{Address: server.URL, TLS: api.TLSConfig{CACert: caCertificate}}
+	if _, err := trusted.Login(loginMethod); err != nil {
+		t.Errorf("Could not log in to Vault with a trusted CA: %s", err)
+	}
+
+	insecure := &VaultAuthenticator{Address: server.URL, TLS: api.TLSConfig{Insecure: true}}
+	if _, err := insecure.Login(loginMethod); err != nil {
+		t.Errorf("Could not log in to Vault without verification: %s", err)
+	}
+
+	invalid := &VaultAuthenticator{Address: server.URL, TLS: api.TLSConfig{ClientCert: caCertificate}}
+	if _, err := invalid.Login(loginMethod); err == nil {
+		t.Error("Did not error on a client certificate without a key")
+	}
+}
+
+func TestVaultEnvironmentVariables(t *testing.T) {
+	server, caCertificate := newTestTLSVault(t)
+	defer server.Close()
+	defer os.RemoveAll(filepath.Dir(caCertificate))
+
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_CACERT", caCertificate)
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_CACERT")
+
+	authenticator := &VaultAuthenticator{}
+	if _, err := authenticator.Login(&UserpassLogin{Username: "test", Password: "test"}); err != nil {
+		t.Errorf("Could not log in using VAULT_ADDR and VAULT_CACERT: %s", err)
+	}
+}
+
+func TestVaultNamespaces(t *testing.T) {
+	namespaces := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespaces[r.URL.Path] = r.Header.Get("X-Vault-Namespace")
+
+		switch r.URL.Path {
+		case "/v1/auth/userpass/login/test":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case "/v1/pki/issue/kugo":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"certificate": "testCertificate", "private_key": "testPrivateKey"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	authenticator := &VaultAuthenticator{
+		Address:       server.URL,
+		AuthNamespace: "admin",
+		PKINamespace:  "admin/team",
+		PKIMount:      "pki",
+		PKIRole:       "kugo",
+	}
+
+	if _, err := authenticator.Authenticate(&UserpassLogin{Username: "test", Password: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if namespaces["/v1/auth/userpass/login/test"] != "admin" {
+		t.Errorf("Logged in to namespace %q", namespaces["/v1/auth/userpass/login/test"])
+	}
+
+	if namespaces["/v1/pki/issue/kugo"] != "admin/team" {
+		t.Errorf("Issued certificate in namespace %q", namespaces["/v1/pki/issue/kugo"])
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,3 +36,77 @@ func DecodeBase64EncodedPEMCertificate(b64Data string) (*x509.Certificate, error
 func CertificateHasExpired(certificate *x509.Certificate) bool {
 	return time.Now().UTC().After(certificate.NotAfter)
 }
+
+// RenewalThreshold describes how close to expiry a certificate may get before it is renewed. Either an absolute
+// duration or a percentage of the certificate's lifetime may be given.
+type RenewalThreshold struct {
+	Duration   time.Duration
+	Percentage float64
+}
+
+// ParseRenewalThreshold parses a duration such as "10m" or a percentage of the certificate lifetime such as "20%"
+func ParseRenewalThreshold(threshold string) (RenewalThreshold, error) {
+	threshold = strings.TrimSpace(threshold)
+	if threshold == "" {
+		return RenewalThreshold{}, nil
+	}
+
+	if strings.HasSuffix(threshold, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil {
+			return RenewalThreshold{}, fmt.Errorf("invalid renewal threshold %q: %w", threshold, err)
+		}
+
+		if percentage < 0 || percentage > 100 {
+			return RenewalThreshold{}, fmt.Errorf("invalid renewal threshold %q: percentage must be between 0 and 100", threshold)
+		}
+
+		return RenewalThreshold{Percentage: percentage}, nil
+	}
+
+	duration, err := time.ParseDuration(threshold)
+	if err != nil {
+		return RenewalThreshold{}, fmt.Errorf("invalid renewal threshold %q: %w", threshold, err)
+	}
+
+	if duration < 0 {
+		return RenewalThreshold{}, fmt.Errorf("invalid renewal threshold %q: duration must not be negative", threshold)
+	}
+
+	return RenewalThreshold{Duration: duration}, nil
+}
+
+// CertificateNeedsRenewal verifies whether the given certificate has expired or will expire within the renewal threshold
+func CertificateNeedsRenewal(certificate *x509.Certificate, threshold RenewalThreshold) bool {
+	if CertificateHasExpired(certificate) {
+		return true
+	}
+
+	return time.Now().UTC().After(CertificateRenewalTime(certificate, threshold))
+}
+
+// CertificateRenewalTime returns when the certificate comes within the renewal threshold of its expiry
+func CertificateRenewalTime(certificate *x509.Certificate, threshold RenewalThreshold) time.Time {
+	window := threshold.Duration
+	if threshold.Percentage > 0 {
+		lifetime := certificate.NotAfter.Sub(certificate.NotBefore)
+		window = time.Duration(float64(lifetime) * threshold.Percentage / 100)
+	}
+
+	return certificate.NotAfter.Add(-window)
+}
+
+// FormatSerialNumber formats a certificate serial number the way Vault displays it, as colon separated hex bytes
+func FormatSerialNumber(serialNumber *big.Int) string {
+	if serialNumber == nil {
+		return ""
+	}
+
+	serialBytes := serialNumber.Bytes()
+	hexBytes := make([]string, len(serialBytes))
+	for index, serialByte := range serialBytes {
+		hexBytes[index] = fmt.Sprintf("%02x", serialByte)
+	}
+
+	return strings.Join(hexBytes, ":")
+}
@@ -75,3 +75,71 @@ func TestExpiryVerificationExpired(t *testing.T) {
 		t.Error("Expired certificate returned as valid")
 	}
 }
+
+func TestRenewalThresholdParsing(t *testing.T) {
+	threshold, err := ParseRenewalThreshold("10m")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if threshold.Duration != 10*time.Minute || threshold.Percentage != 0 {
+		t.Error("Could not parse duration renewal threshold")
+	}
+
+	threshold, err = ParseRenewalThreshold("20%")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if threshold.Percentage != 20 || threshold.Duration != 0 {
+		t.Error("Could not parse percentage renewal threshold")
+	}
+}
+
+func TestRenewalThresholdParsingErrors(t *testing.T) {
+	for _, threshold := range []string{"soon", "150%", "-5m", "abc%"} {
+		if _, err := ParseRenewalThreshold(threshold); err == nil {
+			t.Errorf("Did not error on invalid renewal threshold %s", threshold)
+		}
+	}
+}
+
+func TestRenewalWithDurationThreshold(t *testing.T) {
+	cert := &x509.Certificate{
+		NotBefore: time.Now().UTC().Add(-time.Hour),
+		NotAfter:  time.Now().UTC().Add(5 * time.Minute),
+	}
+
+	if !CertificateNeedsRenewal(cert, RenewalThreshold{Duration: 10 * time.Minute}) {
+		t.Error("Certificate within renewal threshold was not renewed")
+	}
+
+	if CertificateNeedsRenewal(cert, RenewalThreshold{Duration: time.Minute}) {
+		t.Error("Certificate outside renewal threshold was renewed")
+	}
+}
+
+func TestRenewalWithPercentageThreshold(t *testing.T) {
+	cert := &x509.Certificate{
+		NotBefore: time.Now().UTC().Add(-90 * time.Minute),
+		NotAfter:  time.Now().UTC().Add(10 * time.Minute),
+	}
+
+	if !CertificateNeedsRenewal(cert, RenewalThreshold{Percentage: 20}) {
+		t.Error("Certificate within renewal threshold was not renewed")
+	}
+
+	if CertificateNeedsRenewal(cert, RenewalThreshold{Percentage: 5}) {
+		t.Error("Certificate outside renewal threshold was renewed")
+	}
+}
+
+func TestRenewalOfExpiredCertificate(t *testing.T) {
+	cert := &x509.Certificate{
+		NotAfter: time.Now().UTC().Add(-time.Minute),
+	}
+
+	if !CertificateNeedsRenewal(cert, RenewalThreshold{}) {
+		t.Error("Expired certificate was not renewed")
+	}
+}
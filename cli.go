@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// exitCodeError is returned by commands which need kugo to exit with a particular code, such as the exit code of a
+// wrapped executable
+type exitCodeError int
+
+func (code exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(code))
+}
+
+// command is one of kugo's subcommands
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(arguments []string) error
+
+	// claims decides whether kugo handles the command when its name is also a kubectl command. If it doesn't, the
+	// arguments are passed through to kubectl.
+	claims func(arguments []string) bool
+	// explicitOnly commands share their name with a kubectl command which is always passed through, so kugo only runs
+	// them when they follow --kugo
+	explicitOnly bool
+}
+
+// kugoMarker precedes a command to run kugo's command of that name rather than kubectl's, as in `kugo --kugo version`
+const kugoMarker = "--kugo"
+
+// commands lists kugo's subcommands in the order they are shown in help
+func commands() []command {
+	return []command{
+		{name: "run", usage: "run [--exec executable] [--] arguments...", description: "Refresh credentials if needed, then run kubectl or another executable", run: runCommand, claims: claimsRunCommand},
+		{name: "login", usage: "login [--context name]", description: "Log in to Vault using the profile of a context", run: loginCommand},
+		{name: "status", usage: "status [--context name] [--output format]", description: "Show the state of the credentials of every kubeconfig user", run: statusCommand},
+		{name: "refresh", usage: "refresh [--context name|--contexts pattern|--all]", description: "Issue new credentials for contexts, even if they're still valid", run: refreshCommand},
+		{name: "logout", usage: "logout [--context name]", description: "Blank the credentials of a context and revoke the cached Vault token", run: logoutCommand},
+		{name: "config", usage: "config [show|path]", description: "Show kugo's configuration, with secrets redacted, or where it's read from", run: configCommand, claims: claimsConfigCommand},
+		{name: "credential", usage: "credential [--user name] [--context name]", description: "Act as a kubectl exec credential plugin", run: credentialCommand},
+		{name: "version", usage: "--kugo version", description: "Show kugo's version, also shown by kugo --version", run: versionCommand, explicitOnly: true},
+		{name: "completion", usage: "--kugo completion bash|zsh|fish", description: "Generate a shell completion script", run: completionCommand, explicitOnly: true},
+		{name: "help", usage: "--kugo help", description: "Show this help", run: helpCommand, explicitOnly: true},
+	}
+}
+
+// runCommandLine dispatches kugo's arguments to a subcommand. Anything which isn't a kugo subcommand is passed through
+// to the wrapped executable, so `kugo get pods` keeps working.
+func runCommandLine(arguments []string) error {
+	command, commandArguments, err := selectCommand(arguments)
+	if err != nil {
+		return err
+	}
+
+	if command == nil {
+		return runCommand(arguments)
+	}
+
+	return command.run(commandArguments)
+}
+
+// selectCommand finds the kugo command the arguments are for, returning nil if they should be passed through to kubectl
+func selectCommand(arguments []string) (*command, []string, error) {
+	if len(arguments) == 0 {
+		return nil, nil, nil
+	}
+
+	if arguments[0] == "--version" {
+		return findCommand("version"), arguments[1:], nil
+	}
+
+	if arguments[0] == kugoMarker {
+		if len(arguments) == 1 {
+			return findCommand("help"), nil, nil
+		}
+
+		command := findCommand(arguments[1])
+		if command == nil {
+			return nil, nil, fmt.Errorf("unknown kugo command %q, see kugo --kugo help", arguments[1])
+		}
+
+		return command, arguments[2:], nil
+	}
+
+	command := findCommand(arguments[0])
+	if command == nil || command.explicitOnly || (command.claims != nil && !command.claims(arguments[1:])) {
+		return nil, nil, nil
+	}
+
+	return command, arguments[1:], nil
+}
+
+func findCommand(name string) *command {
+	for _, command := range commands() {
+		if command.name == name {
+			return &command
+		}
+	}
+
+	return nil
+}
+
+// parseRunArguments splits the arguments of the run command into the executable to run and the arguments to pass
+// through to it. The executable may be given with --exec or the older -executable flag, in either "--exec helm" or
+// "--exec=helm" form, and "--" may be used to mark the start of the passed through arguments.
+func parseRunArguments(arguments []string) (string, []string) {
+	executable := "kubectl"
+
+	if len(arguments) > 0 && isExecutableFlag(arguments[0]) {
+		flagAndValue := strings.SplitN(arguments[0], "=", 2)
+		if len(flagAndValue) == 2 {
+			executable = flagAndValue[1]
+			arguments = arguments[1:]
+		} else if len(arguments) > 1 {
+			executable = arguments[1]
+			arguments = arguments[2:]
+		} else {
+			arguments = arguments[1:]
+		}
+	}
+
+	if len(arguments) > 0 && arguments[0] == "--" {
+		arguments = arguments[1:]
+	}
+
+	return executable, arguments
+}
+
+func isExecutableFlag(argument string) bool {
+	name := strings.SplitN(argument, "=", 2)[0]
+	return name == "--exec" || name == "-exec" || name == "--executable" || name == "-executable"
+}
+
+func claimsRunCommand(arguments []string) bool {
+	// `kubectl run NAME` starts with the name of a pod, whereas kugo's run starts with its own flags or "--"
+	return len(arguments) == 0 || arguments[0] == "--" || isExecutableFlag(arguments[0])
+}
+
+func claimsConfigCommand(arguments []string) bool {
+	return len(arguments) == 0 || arguments[0] == "show" || arguments[0] == "path"
+}
+
+// selectionFlags adds the flags shared by commands which operate on a kubeconfig context
+func selectionFlags(flags *flag.FlagSet) *KubernetesSelection {
+	selection := &KubernetesSelection{}
+	flags.StringVar(&selection.Context, "context", "", "Kubernetes context to use (defaults to the current context)")
+	flags.StringVar(&selection.User, "user", "", "Kubernetes user to use (defaults to the user of the context)")
+	flags.StringVar(&selection.Kubeconfig, "kubeconfig", "", "Kubeconfig file to use (defaults to $KUBECONFIG or $HOME/.kube/config)")
+	return selection
+}
+
+// printUsage writes kugo's help text
+func printUsage(output io.Writer) {
+	fmt.Fprintln(output, "kugo refreshes Kubernetes credentials from Hashicorp Vault before running kubectl or other tools.")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "Usage:")
+	fmt.Fprintln(output, "  kugo [kubectl arguments...]")
+	for _, command := range commands() {
+		fmt.Fprintf(output, "  kugo %-44s %s\n", command.usage, command.description)
+	}
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "Any arguments which aren't a kugo command are passed through to kubectl. kubectl's version, completion and")
+	fmt.Fprintln(output, "help commands are always passed through, so kugo's are run with --kugo.")
+}
+
+func helpCommand(arguments []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRunArguments(t *testing.T) {
+	cases := []struct {
+		arguments          []string
+		expectedExecutable string
+		expectedArguments  []string
+	}{
+		{[]string{"get", "pods"}, "kubectl", []string{"get", "pods"}},
+		{[]string{"-executable=helm", "install", "stable/nginx"}, "helm", []string{"install", "stable/nginx"}},
+		{[]string{"-executable", "helm", "install"}, "helm", []string{"install"}},
+		{[]string{"--exec", "telepresence", "--", "--namespace", "test"}, "telepresence", []string{"--namespace", "test"}},
+		{[]string{"--", "run", "nginx"}, "kubectl", []string{"run", "nginx"}},
+	}
+
+	for _, c := range cases {
+		executable, arguments := parseRunArguments(c.arguments)
+		if executable != c.expectedExecutable {
+			t.Errorf("Parsed executable %s from %q, expected %s", executable, c.arguments, c.expectedExecutable)
+		}
+
+		if strings.Join(arguments, " ") != strings.Join(c.expectedArguments, " ") {
+			t.Errorf("Parsed arguments %q from %q, expected %q", arguments, c.arguments, c.expectedArguments)
+		}
+	}
+}
+
+func TestCommandsSharedWithKubectl(t *testing.T) {
+	if claimsRunCommand([]string{"nginx", "--image=nginx"}) {
+		t.Error("kubectl run was treated as kugo run")
+	}
+
+	if !claimsRunCommand([]string{"--exec", "helm", "list"}) {
+		t.Error("kugo run was not recognised")
+	}
+
+	if claimsConfigCommand([]string{"use-context", "prod"}) {
+		t.Error("kubectl config was treated as kugo config")
+	}
+
+	if !claimsConfigCommand([]string{"show"}) {
+		t.Error("kugo config was not recognised")
+	}
+
+	for _, arguments := range [][]string{{"version"}, {"version", "--client"}, {"help"}, {"completion", "bash"}, {"run", "nginx"}} {
+		command, _, err := selectCommand(arguments)
+		if err != nil || command != nil {
+			t.Errorf("kubectl %q was not passed through", arguments)
+		}
+	}
+
+	for arguments, expected := range map[string]string{
+		"--version":                 "version",
+		"--kugo version":            "version",
+		"--kugo help":               "help",
+		"--kugo":                    "help",
+		"--kugo completion bash":    "completion",
+		"--kugo config use-context": "config",
+		"status":                    "status",
+	} {
+		command, _, err := selectCommand(strings.Fields(arguments))
+		if err != nil || command == nil || command.name != expected {
+			t.Errorf("kugo %s did not select kugo's %s command", arguments, expected)
+		}
+	}
+
+	if _, _, err := selectCommand([]string{"--kugo", "get"}); err == nil {
+		t.Error("Did not error on an unknown kugo command")
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(script, "refresh") || !strings.Contains(script, "status") {
+			t.Errorf("%s completion does not include kugo's commands", shell)
+		}
+
+		// version, completion and help are kubectl commands too, so they are only offered once after --kugo
+		if strings.Count(script, "version") != 1 || !strings.Contains(script, "--kugo") {
+			t.Errorf("%s completion offers commands which only run after --kugo as the first word", shell)
+		}
+	}
+
+	if _, err := completionScript("tcsh"); err == nil {
+		t.Error("Did not error on unsupported shell")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+	"github.com/bnmcg/kugo/logging"
+)
+
+// runCommand refreshes the credentials the wrapped executable is going to use if they need renewal, then runs it
+func runCommand(arguments []string) error {
+	executable, arguments := parseRunArguments(arguments)
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	// The credentials to refresh may be chosen by the wrapped executable's arguments
+	selection := KubernetesSelection{}
+	if flags, ok := executableFlags(executable, kugoConfiguration.Executables); ok {
+		selection = ParseKubernetesSelection(arguments, flags)
+	}
+
+	err = refreshCredentials(kugoConfiguration, selection, false)
+	if err != nil {
+		return err
+	}
+
+	logging.Tracef("Running %s with arguments %q", executable, redactArguments(arguments))
+	if kugoConfiguration.ReplaceProcess {
+		return replaceProcess(executable, arguments)
+	}
+
+	exitCode, err := runExecutable(executable, arguments)
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return exitCodeError(exitCode)
+	}
+
+	return nil
+}
+
+// loginCommand logs in to Vault using the profile of the selected context, to check that the profile works
+func loginCommand(arguments []string) error {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	selection := selectionFlags(flags)
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	_, kubeconfig, err := loadSelectedKubeconfig(*selection)
+	if err != nil {
+		return err
+	}
+
+	context, user := resolveKubernetesSelection(kubeconfig, *selection)
+	profile := kugoConfiguration.ProfileFor(context.Name, context.Context.Cluster)
+
+	if _, err := loginToVault(profile, context, user); err != nil {
+		return err
+	}
+
+	logging.Infof("Logged in to Vault at %s using %s authentication (profile %q)", profile.VaultAddress, profile.VaultAuthMethod, profile.Name)
+	return nil
+}
+
+// statusCommand shows the state of the client certificate of every kubeconfig user, or just the users of the selected
+// context
+func statusCommand(arguments []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	selection := selectionFlags(flags)
+	output := flags.String("output", outputTable, "Output format, one of table, json or yaml")
+	flags.StringVar(output, "o", outputTable, "Shorthand for --output")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	_, kubeconfig, err := loadSelectedKubeconfig(*selection)
+	if err != nil {
+		return err
+	}
+
+	statuses := CredentialStatuses(kubeconfig, kugoConfiguration)
+	if selection.Context != "" || selection.User != "" {
+		_, user := resolveKubernetesSelection(kubeconfig, *selection)
+
+		selected := []CredentialStatus{}
+		for _, status := range statuses {
+			if status.User == user.Name {
+				selected = append(selected, status)
+			}
+		}
+
+		statuses = selected
+	}
+
+	return WriteCredentialStatuses(os.Stdout, statuses, *output)
+}
+
+// refreshCommand issues new credentials for the selected context, regardless of whether the current ones are valid.
+// With --all or --contexts, the users of every matching context are refreshed together.
+func refreshCommand(arguments []string) error {
+	flags := flag.NewFlagSet("refresh", flag.ContinueOnError)
+	selection := selectionFlags(flags)
+	all := flags.Bool("all", false, "Refresh every context whose user is managed by kugo")
+	contexts := flags.String("contexts", "", "Comma separated context name patterns to refresh, such as 'prod-*'")
+	concurrency := flags.Int("parallel", DefaultRefreshConcurrency, "Number of certificates to request at once")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	patterns := []string{}
+	if *all {
+		patterns = []string{"*"}
+	} else if *contexts != "" {
+		patterns = strings.Split(*contexts, ",")
+	}
+
+	if len(patterns) == 0 {
+		return refreshCredentials(kugoConfiguration, *selection, true)
+	}
+
+	results, err := refreshContexts(kugoConfiguration, *selection, patterns, *concurrency)
+	if err != nil {
+		return err
+	}
+
+	failed, err := writeRefreshSummary(os.Stdout, results)
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to refresh %d of %d contexts", failed, len(results))
+	}
+
+	return nil
+}
+
+// logoutCommand blanks the client certificate and key of the selected context's user in the kubeconfig, and revokes
+// the cached Vault token of the context's profile
+func logoutCommand(arguments []string) error {
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	selection := selectionFlags(flags)
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	kubeconfigPaths, kubeconfig, err := loadSelectedKubeconfig(*selection)
+	if err != nil {
+		return err
+	}
+
+	context, user := resolveKubernetesSelection(kubeconfig, *selection)
+	if user.Name == "" {
+		return fmt.Errorf("could not find the user of context %q", context.Name)
+	}
+
+	// The certificate and key are blanked rather than removed, so the rest of the kubeconfig is left as it was. Users
+	// which kugo doesn't manage are left alone.
+	if user.User.ClientCertificateData != "" {
+		err = UpdateKubeconfigUsers(kubeconfigPaths, map[string]authentication.KubernetesCredentials{
+			user.Name: {},
+		}, kugoConfiguration.KubeconfigBackups)
+		if err != nil {
+			return err
+		}
+
+		logging.Infof("Blanked the credentials of user %q", user.Name)
+	}
+
+	profile := kugoConfiguration.ProfileFor(context.Name, context.Context.Cluster)
+	if err := removeCachedCredentials(credentialCachePath(authentication.DefaultTokenCacheDirectory(), profile, context, user)); err != nil {
+		return err
+	}
+
+	authenticator, err := newVaultAuthenticator(profile, context, user)
+	if err != nil {
+		return err
+	}
+
+	return authenticator.Logout()
+}
+
+// configCommand shows the effective configuration with secrets redacted, or the path it's read from
+func configCommand(arguments []string) error {
+	if len(arguments) > 0 && arguments[0] == "path" {
+		fmt.Println(configuration.ConfigurationPath())
+		return nil
+	}
+
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	redacted, err := kugoConfiguration.MarshalRedacted()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(redacted)
+	return err
+}
+
+// credentialCommand acts as a kubectl exec credential plugin
+func credentialCommand(arguments []string) error {
+	kugoConfiguration, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	return runCredentialPlugin(arguments, kugoConfiguration, os.Stdout)
+}
+
+// versionCommand shows kugo's version
+func versionCommand(arguments []string) error {
+	fmt.Printf("kugo %s\n", version)
+	return nil
+}
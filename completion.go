@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const bashCompletion = `# kugo bash completion
+_kugo() {
+    local current="${COMP_WORDS[COMP_CWORD]}"
+    local position=1
+    if [ "${COMP_WORDS[1]}" = "--kugo" ]; then
+        position=2
+    fi
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "%[1]s --kugo" -- "$current"))
+        return
+    fi
+
+    if [ "$COMP_CWORD" -eq 2 ] && [ "$position" -eq 2 ]; then
+        COMPREPLY=($(compgen -W "%[2]s" -- "$current"))
+        return
+    fi
+
+    case "${COMP_WORDS[position]}" in
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$current"))
+            ;;
+        config)
+            COMPREPLY=($(compgen -W "show path" -- "$current"))
+            ;;
+        login|status|refresh|logout)
+            COMPREPLY=($(compgen -W "--context --user --kubeconfig" -- "$current"))
+            ;;
+    esac
+}
+complete -o default -F _kugo kugo
+`
+
+const zshCompletion = `#compdef kugo
+# kugo zsh completion
+_kugo() {
+    local position=2
+    if [[ "${words[2]}" == "--kugo" ]]; then
+        position=3
+    fi
+
+    if (( CURRENT == 2 )); then
+        compadd -- %[1]s --kugo
+        return
+    fi
+
+    if (( CURRENT == 3 && position == 3 )); then
+        compadd -- %[2]s
+        return
+    fi
+
+    case "${words[position]}" in
+        completion) _values 'shell' bash zsh fish ;;
+        config) _values 'action' show path ;;
+        login|status|refresh|logout) _values 'flag' --context --user --kubeconfig ;;
+        *) _files ;;
+    esac
+}
+compdef _kugo kugo
+`
+
+const fishCompletion = `# kugo fish completion
+complete -c kugo -f -n "test (count (commandline -opc)) -eq 1" -a "%[1]s --kugo"
+complete -c kugo -f -n "test (count (commandline -opc)) -eq 2; and test (commandline -opc)[2] = --kugo" -a "%[2]s"
+complete -c kugo -f -n "__fish_seen_subcommand_from completion" -a "bash zsh fish"
+complete -c kugo -f -n "__fish_seen_subcommand_from config" -a "show path"
+complete -c kugo -n "__fish_seen_subcommand_from login status refresh logout" -l context -r
+complete -c kugo -n "__fish_seen_subcommand_from login status refresh logout" -l user -r
+complete -c kugo -n "__fish_seen_subcommand_from login status refresh logout" -l kubeconfig -r
+`
+
+// completionScript generates a completion script for kugo's commands in the given shell. Commands which are only run
+// after --kugo, as their names are also kubectl commands, are only offered after it.
+func completionScript(shell string) (string, error) {
+	names, allNames := []string{}, []string{}
+	for _, command := range commands() {
+		if !command.explicitOnly {
+			names = append(names, command.name)
+		}
+		allNames = append(allNames, command.name)
+	}
+
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return "", fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+
+	return fmt.Sprintf(script, strings.Join(names, " "), strings.Join(allNames, " ")), nil
+}
+
+// completionCommand writes a shell completion script to stdout
+func completionCommand(arguments []string) error {
+	if len(arguments) != 1 {
+		return fmt.Errorf("usage: kugo --kugo completion bash|zsh|fish")
+	}
+
+	script, err := completionScript(arguments[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(script)
+	return err
+}
@@ -1,38 +1,240 @@
 package configuration
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 
 	"gopkg.in/yaml.v2"
 )
 
-// KugoConfiguration is the wrapper configuration
+// DefaultKubeconfigBackups is the number of kubeconfig backups kept unless configured otherwise
+const DefaultKubeconfigBackups = 3
+
+// Names of the Vault authentication methods which may be selected with vault_auth_method
+const (
+	AuthMethodUserpass   = "userpass"
+	AuthMethodAppRole    = "approle"
+	AuthMethodToken      = "token"
+	AuthMethodLDAP       = "ldap"
+	AuthMethodOIDC       = "oidc"
+	AuthMethodCert       = "cert"
+	AuthMethodKubernetes = "kubernetes"
+	AuthMethodJWT        = "jwt"
+)
+
+// KugoConfiguration is the wrapper configuration. The Vault settings at the top level form the default profile, which
+// is used for any context that doesn't match one of the named profiles.
 type KugoConfiguration struct {
-	VaultAddress  string `yaml:"vault_address"`
-	VaultUsername string `yaml:"vault_username"`
-	VaultPassword string `yaml:"vault_password"`
-	VaultPKIRole  string `yaml:"vault_pki_role"`
-	VaultPKIMount string `yaml:"vault_pki_mount"`
+	Profile  `yaml:",inline"`
+	Profiles map[string]Profile `yaml:"-"`
+
+	// KubernetesRenewalThreshold renews certificates before they expire, either a duration such as "10m" or a
+	// percentage of the certificate lifetime such as "20%"
+	KubernetesRenewalThreshold string `yaml:"kubernetes_renewal_threshold"`
+
+	// Executables describes the flags wrapped executables use to select a kubeconfig, context or user, keyed by the
+	// executable's name. kubectl and helm are understood without any configuration.
+	Executables map[string]ExecutableFlags `yaml:"executables"`
+
+	// ReplaceProcess execs the wrapped executable in place of kugo rather than running it as a child process
+	ReplaceProcess bool `yaml:"replace_process"`
+
+	// LogLevel is one of quiet, info, debug or trace, and may be overridden with KUGO_LOG_LEVEL
+	LogLevel string `yaml:"log_level"`
+	// LogFile receives a copy of kugo's log messages when set
+	LogFile string `yaml:"log_file"`
+
+	// KubeconfigBackups is the number of previous versions of a kubeconfig file kept when it is updated
+	KubeconfigBackups int `yaml:"kubeconfig_backups"`
+
+	// Warnings describes problems with the configuration which don't stop kugo from working, such as secrets stored
+	// in plaintext
+	Warnings []string `yaml:"-"`
+}
+
+// VaultTLSConfiguration configures the TLS connection to Vault. Settings which aren't given fall back to the
+// VAULT_CACERT, VAULT_CAPATH, VAULT_CLIENT_CERT, VAULT_CLIENT_KEY, VAULT_TLS_SERVER_NAME and VAULT_SKIP_VERIFY
+// environment variables used by the Vault CLI.
+type VaultTLSConfiguration struct {
+	CACert        string `yaml:"ca_cert"`
+	CAPath        string `yaml:"ca_path"`
+	ClientCert    string `yaml:"client_cert"`
+	ClientKey     string `yaml:"client_key"`
+	TLSServerName string `yaml:"tls_server_name"`
+
+	// Insecure disables verification of Vault's certificate, which should only ever be used for testing
+	Insecure bool `yaml:"insecure"`
+}
+
+// VaultAuthConfiguration holds the settings for each Vault authentication method
+type VaultAuthConfiguration struct {
+	Userpass   UserpassConfiguration   `yaml:"userpass"`
+	AppRole    AppRoleConfiguration    `yaml:"approle"`
+	Token      TokenConfiguration      `yaml:"token"`
+	LDAP       LDAPConfiguration       `yaml:"ldap"`
+	OIDC       OIDCConfiguration       `yaml:"oidc"`
+	Cert       CertConfiguration       `yaml:"cert"`
+	Kubernetes KubernetesConfiguration `yaml:"kubernetes"`
+	JWT        JWTConfiguration        `yaml:"jwt"`
+}
+
+// UserpassConfiguration configures the username/password authentication method
+type UserpassConfiguration struct {
+	Mount    string `yaml:"mount"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+}
+
+// AppRoleConfiguration configures the AppRole authentication method
+type AppRoleConfiguration struct {
+	Mount    string `yaml:"mount"`
+	RoleID   string `yaml:"role_id"`
+	SecretID Secret `yaml:"secret_id"`
+}
+
+// TokenConfiguration configures authentication with an existing Vault token. If no token is configured, the
+// VAULT_TOKEN environment variable is used.
+type TokenConfiguration struct {
+	Token Secret `yaml:"token"`
+}
+
+// LDAPConfiguration configures the LDAP authentication method
+type LDAPConfiguration struct {
+	Mount    string `yaml:"mount"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+}
+
+// OIDCConfiguration configures login through an OIDC provider in the browser
+type OIDCConfiguration struct {
+	Mount string `yaml:"mount"`
+	Role  string `yaml:"role"`
+
+	// ListenAddress is where kugo waits for the provider's redirect, which the role's allowed_redirect_uris must
+	// permit as http://<listen_address>/oidc/callback
+	ListenAddress string `yaml:"listen_address"`
+	// Timeout is how long to wait for the login to complete in the browser, such as "2m"
+	Timeout string `yaml:"timeout"`
+	// SkipBrowser prints the login URL rather than opening it, for machines without a browser
+	SkipBrowser bool `yaml:"skip_browser"`
+}
+
+// CertConfiguration configures the TLS certificate authentication method. ClientCert and ClientKey override
+// vault_tls.client_cert and vault_tls.client_key, so a machine certificate may be used without configuring vault_tls.
+type CertConfiguration struct {
+	Mount      string `yaml:"mount"`
+	Role       string `yaml:"role"`
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+}
 
-	KubernetesPKITTL string `yaml:"kubernetes_pki_ttl"`
+// KubernetesConfiguration configures the Kubernetes authentication method, used when kugo runs inside a pod
+type KubernetesConfiguration struct {
+	Mount string `yaml:"mount"`
+	Role  string `yaml:"role"`
+	// TokenPath is the service account token to log in with, defaulting to the token Kubernetes projects into the pod
+	TokenPath string `yaml:"token_path"`
+	// CacheToken keeps the Vault token in the token cache. It's off by default, as the cache may outlive the pod on a
+	// persistent CI runner and hand the token to a later job.
+	CacheToken bool `yaml:"cache_token"`
+}
+
+// JWTConfiguration configures the JWT authentication method, such as for the identity tokens CI systems give their jobs
+type JWTConfiguration struct {
+	Mount string `yaml:"mount"`
+	Role  string `yaml:"role"`
+	JWT   Secret `yaml:"jwt"`
+	// CacheToken keeps the Vault token in the token cache. It's off by default, as the cache may outlive the job on a
+	// persistent CI runner and hand the token to a later job.
+	CacheToken bool `yaml:"cache_token"`
+}
+
+// ExecutableFlags lists the command line flags an executable uses to select a kubeconfig, context or user
+type ExecutableFlags struct {
+	Context    []string `yaml:"context"`
+	Kubeconfig []string `yaml:"kubeconfig"`
+	User       []string `yaml:"user"`
+}
+
+// ConfigurationPath returns the location of kugo's configuration file, $HOME/.kugo.yaml
+func ConfigurationPath() string {
+	homeDirectory := os.Getenv("HOME")
+	return path.Join(homeDirectory, ".kugo.yaml")
 }
 
 // LoadConfiguration from $HOME/.kugo.yaml
 func LoadConfiguration() (KugoConfiguration, error) {
-	homeDirectory := os.Getenv("HOME")
-	configurationPath := path.Join(homeDirectory, ".kugo.yaml")
-	configurationBytes, err := ioutil.ReadFile(configurationPath)
+	configurationBytes, err := ioutil.ReadFile(ConfigurationPath())
 	if err != nil {
 		return KugoConfiguration{}, err
 	}
 
-	configuration := KugoConfiguration{}
-	err = yaml.Unmarshal(configurationBytes, &configuration)
+	return ParseConfiguration(configurationBytes)
+}
+
+// ParseConfiguration into struct, applying defaults for any settings which were not given
+func ParseConfiguration(configurationBytes []byte) (KugoConfiguration, error) {
+	configuration := KugoConfiguration{
+		KubeconfigBackups: DefaultKubeconfigBackups,
+	}
+	err := yaml.Unmarshal(configurationBytes, &configuration)
 	if err != nil {
 		return KugoConfiguration{}, err
 	}
 
+	// Each profile starts as a copy of the default profile, so that it only needs to set what differs
+	rawProfiles := struct {
+		Profiles map[string]yaml.MapSlice `yaml:"profiles"`
+	}{}
+	err = yaml.Unmarshal(configurationBytes, &rawProfiles)
+	if err != nil {
+		return KugoConfiguration{}, err
+	}
+
+	configuration.Warnings = plaintextSecretWarnings(DefaultProfileName, configuration.Profile)
+
+	configuration.Profiles = map[string]Profile{}
+	for name, rawProfile := range rawProfiles.Profiles {
+		profile, err := configuration.Profile.extend(rawProfile)
+		if err != nil {
+			return KugoConfiguration{}, fmt.Errorf("invalid profile %s: %w", name, err)
+		}
+
+		// Only warn about the secrets the profile sets itself, rather than those it shares with the default profile
+		ownSettings, err := Profile{}.extend(rawProfile)
+		if err != nil {
+			return KugoConfiguration{}, fmt.Errorf("invalid profile %s: %w", name, err)
+		}
+		configuration.Warnings = append(configuration.Warnings, plaintextSecretWarnings(name, ownSettings)...)
+
+		profile.Name = name
+		profile.applyDefaults()
+		configuration.Profiles[name] = profile
+	}
+
+	sort.Strings(configuration.Warnings)
+
+	configuration.Profile.Name = DefaultProfileName
+	configuration.Profile.applyDefaults()
+
 	return configuration, nil
 }
+
+// MarshalRedacted serializes the effective configuration, including every profile, with secrets replaced so that it
+// may be shown safely
+func (configuration KugoConfiguration) MarshalRedacted() ([]byte, error) {
+	redactedProfiles := map[string]Profile{}
+	for name, profile := range configuration.Profiles {
+		redactedProfiles[name] = profile.redacted()
+	}
+
+	configuration.Profile = configuration.Profile.redacted()
+
+	return yaml.Marshal(struct {
+		KugoConfiguration `yaml:",inline"`
+		Profiles          map[string]Profile `yaml:"profiles,omitempty"`
+	}{configuration, redactedProfiles})
+}
@@ -0,0 +1,188 @@
+package configuration
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultProfileName is the name given to the profile made up of the top level Vault settings
+const DefaultProfileName = "default"
+
+// Profile holds the Vault and certificate settings used to authenticate to a set of Kubernetes clusters
+type Profile struct {
+	Name string `yaml:"-"`
+
+	// VaultAddress defaults to the VAULT_ADDR environment variable
+	VaultAddress string                `yaml:"vault_address"`
+	VaultTLS     VaultTLSConfiguration `yaml:"vault_tls"`
+
+	// VaultNamespace is the Vault Enterprise namespace to use, defaulting to the VAULT_NAMESPACE environment variable.
+	// VaultAuthNamespace and VaultPKINamespace override it for logging in and issuing certificates respectively.
+	VaultNamespace     string `yaml:"vault_namespace"`
+	VaultAuthNamespace string `yaml:"vault_auth_namespace"`
+	VaultPKINamespace  string `yaml:"vault_pki_namespace"`
+
+	VaultAuthMethod string                 `yaml:"vault_auth_method"`
+	VaultAuth       VaultAuthConfiguration `yaml:"vault_auth"`
+	VaultPKIRole    string                 `yaml:"vault_pki_role"`
+	VaultPKIMount   string                 `yaml:"vault_pki_mount"`
+	VaultPKIMode    string                 `yaml:"vault_pki_mode"`
+	VaultPKIKeyType string                 `yaml:"vault_pki_key_type"`
+
+	// VaultUsername and VaultPassword configure userpass authentication for configuration files written before
+	// vault_auth was introduced
+	VaultUsername string `yaml:"vault_username"`
+	VaultPassword Secret `yaml:"vault_password"`
+
+	KubernetesPKITTL string `yaml:"kubernetes_pki_ttl"`
+
+	// KubernetesCommonName is a template for the common name of issued certificates. .User, .Context and .Cluster
+	// refer to the kubeconfig entries being refreshed. Defaults to the kubeconfig user's name.
+	KubernetesCommonName string `yaml:"kubernetes_common_name"`
+}
+
+// CommonNameData is made available to the common name template of a profile
+type CommonNameData struct {
+	User    string
+	Context string
+	Cluster string
+}
+
+// extend creates a copy of the profile with the settings in rawProfile applied over the top
+func (profile Profile) extend(rawProfile yaml.MapSlice) (Profile, error) {
+	profileBytes, err := yaml.Marshal(rawProfile)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	extended := profile
+	err = yaml.Unmarshal(profileBytes, &extended)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	return extended, nil
+}
+
+func (profile *Profile) applyDefaults() {
+	if profile.VaultAuthMethod == "" {
+		profile.VaultAuthMethod = AuthMethodUserpass
+	}
+
+	if profile.VaultAuthNamespace == "" {
+		profile.VaultAuthNamespace = profile.VaultNamespace
+	}
+
+	if profile.VaultPKINamespace == "" {
+		profile.VaultPKINamespace = profile.VaultNamespace
+	}
+
+	if profile.VaultAuth.Userpass.Username == "" {
+		profile.VaultAuth.Userpass.Username = profile.VaultUsername
+		profile.VaultAuth.Userpass.Password = profile.VaultPassword
+	}
+
+	if !profile.VaultAuth.Token.Token.IsSet() {
+		profile.VaultAuth.Token.Token = Secret{Value: os.Getenv("VAULT_TOKEN")}
+	}
+}
+
+// plaintextSecretWarnings describes each secret the profile stores in the configuration file itself
+func plaintextSecretWarnings(name string, profile Profile) []string {
+	secrets := []struct {
+		setting string
+		secret  Secret
+	}{
+		{"vault_password", profile.VaultPassword},
+		{"vault_auth.userpass.password", profile.VaultAuth.Userpass.Password},
+		{"vault_auth.approle.secret_id", profile.VaultAuth.AppRole.SecretID},
+		{"vault_auth.token.token", profile.VaultAuth.Token.Token},
+		{"vault_auth.ldap.password", profile.VaultAuth.LDAP.Password},
+		{"vault_auth.jwt.jwt", profile.VaultAuth.JWT.JWT},
+	}
+
+	warnings := []string{}
+	for _, secret := range secrets {
+		if secret.secret.Value != "" {
+			warnings = append(warnings, fmt.Sprintf("%s in profile %s is stored in plaintext in %s, consider reading it from an env var, file, command or prompt instead", secret.setting, name, ConfigurationPath()))
+		}
+	}
+
+	return warnings
+}
+
+// redactedValue replaces secrets when configuration is shown
+const redactedValue = "<redacted>"
+
+// redacted returns a copy of the profile with every secret replaced
+func (profile Profile) redacted() Profile {
+	profile.VaultPassword = profile.VaultPassword.redacted()
+	profile.VaultAuth.Userpass.Password = profile.VaultAuth.Userpass.Password.redacted()
+	profile.VaultAuth.AppRole.SecretID = profile.VaultAuth.AppRole.SecretID.redacted()
+	profile.VaultAuth.Token.Token = profile.VaultAuth.Token.Token.redacted()
+	profile.VaultAuth.LDAP.Password = profile.VaultAuth.LDAP.Password.redacted()
+	profile.VaultAuth.JWT.JWT = profile.VaultAuth.JWT.JWT.redacted()
+	return profile
+}
+
+// CommonName renders the common name to request certificates with
+func (profile Profile) CommonName(data CommonNameData) (string, error) {
+	if profile.KubernetesCommonName == "" {
+		return data.User, nil
+	}
+
+	commonNameTemplate, err := template.New("common name").Option("missingkey=error").Parse(profile.KubernetesCommonName)
+	if err != nil {
+		return "", err
+	}
+
+	commonName := bytes.Buffer{}
+	err = commonNameTemplate.Execute(&commonName, data)
+	if err != nil {
+		return "", err
+	}
+
+	return commonName.String(), nil
+}
+
+// ProfileFor selects the profile for a kubeconfig context. Profiles are keyed by context or cluster name, and keys may
+// be glob patterns. An exact match on the context wins, followed by an exact match on the cluster, then the longest
+// matching pattern. If no profile matches, the default profile is returned.
+func (configuration KugoConfiguration) ProfileFor(context string, cluster string) Profile {
+	if profile, ok := configuration.Profiles[context]; ok && context != "" {
+		return profile
+	}
+
+	if profile, ok := configuration.Profiles[cluster]; ok && cluster != "" {
+		return profile
+	}
+
+	patterns := []string{}
+	for pattern := range configuration.Profiles {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		for _, name := range []string{context, cluster} {
+			if matched, _ := path.Match(pattern, name); matched && name != "" {
+				return configuration.Profiles[pattern]
+			}
+		}
+	}
+
+	return configuration.Profile
+}
@@ -0,0 +1,154 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+)
+
+var exampleProfilesConfiguration = `
+vault_address: https://vault:8443
+vault_username: kugo
+vault_password: password
+vault_pki_role: kugo-pki
+vault_pki_mount: pki
+kubernetes_pki_ttl: 1d
+profiles:
+  prod-*:
+    vault_address: https://vault.prod:8443
+    vault_pki_mount: pki-prod
+    kubernetes_common_name: "{{.User}}@{{.Cluster}}"
+  prod-eu-*:
+    vault_pki_role: kugo-eu
+  staging:
+    vault_auth_method: approle
+    vault_auth:
+      approle:
+        role_id: testRoleID
+        secret_id: testSecretID
+    kubernetes_pki_ttl: 1h`
+
+func TestDefaultProfile(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := configuration.ProfileFor("dev", "dev-cluster")
+	if profile.Name != DefaultProfileName {
+		t.Error("Did not fall back to the default profile")
+	}
+
+	if profile.VaultAuth.Userpass.Username != "kugo" {
+		t.Error("Legacy credentials were not applied to the default profile")
+	}
+}
+
+func TestProfileInheritsDefaults(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := configuration.ProfileFor("staging", "staging-cluster")
+	if profile.Name != "staging" {
+		t.Fatal("Did not select profile by context name")
+	}
+
+	if profile.VaultAddress != "https://vault:8443" || profile.VaultPKIMount != "pki" {
+		t.Error("Profile did not inherit default settings")
+	}
+
+	if profile.VaultAuthMethod != AuthMethodAppRole || profile.VaultAuth.AppRole.RoleID != "testRoleID" {
+		t.Error("Profile did not override authentication settings")
+	}
+
+	if profile.KubernetesPKITTL != "1h" {
+		t.Error("Profile did not override TTL")
+	}
+
+	if profile.VaultAuth.Userpass.Username != "kugo" {
+		t.Error("Profile did not inherit userpass settings")
+	}
+}
+
+func TestProfileGlobMatching(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configuration.ProfileFor("admin@prod-us-1", "prod-us-1").Name != "prod-*" {
+		t.Error("Did not select profile by cluster pattern")
+	}
+
+	if configuration.ProfileFor("prod-eu-1", "cluster").Name != "prod-eu-*" {
+		t.Error("Did not prefer the most specific pattern")
+	}
+}
+
+func TestProfileCommonName(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := CommonNameData{User: "admin", Context: "admin@prod-us-1", Cluster: "prod-us-1"}
+
+	commonName, err := configuration.ProfileFor(data.Context, data.Cluster).CommonName(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commonName != "admin@prod-us-1" {
+		t.Errorf("Incorrect common name %s", commonName)
+	}
+
+	commonName, err = configuration.Profile.CommonName(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commonName != "admin" {
+		t.Error("Common name did not default to the user name")
+	}
+}
+
+func TestMarshalRedacted(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := configuration.MarshalRedacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(redacted), "password: password") || strings.Contains(string(redacted), "testSecretID") {
+		t.Error("Secrets were not redacted")
+	}
+
+	if !strings.Contains(string(redacted), "staging:") || !strings.Contains(string(redacted), "testRoleID") {
+		t.Error("Profiles were not included")
+	}
+}
+
+func TestProfileNamespaces(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(`
+vault_namespace: admin
+profiles:
+  team:
+    vault_pki_namespace: admin/team`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configuration.VaultAuthNamespace != "admin" || configuration.VaultPKINamespace != "admin" {
+		t.Error("Namespace was not used for both login and issuance")
+	}
+
+	team := configuration.Profiles["team"]
+	if team.VaultAuthNamespace != "admin" || team.VaultPKINamespace != "admin/team" {
+		t.Error("PKI namespace did not override the namespace")
+	}
+}
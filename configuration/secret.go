@@ -0,0 +1,106 @@
+package configuration
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Secret is a credential setting. It may be written in the configuration file as a plain string, or as a mapping which
+// says where to read it from when it's needed: an environment variable, a file, the output of a command, or a prompt
+// on the terminal.
+type Secret struct {
+	Value   string `yaml:"value,omitempty"`
+	Env     string `yaml:"env,omitempty"`
+	File    string `yaml:"file,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	Prompt  bool   `yaml:"prompt,omitempty"`
+}
+
+// UnmarshalYAML accepts either a plain string or a mapping naming the source of the secret
+func (secret *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	value := ""
+	if err := unmarshal(&value); err == nil {
+		*secret = Secret{Value: value}
+		return nil
+	}
+
+	type rawSecret Secret
+	raw := rawSecret{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*secret = Secret(raw)
+	return nil
+}
+
+// MarshalYAML writes secrets given as a plain string back in the same form
+func (secret Secret) MarshalYAML() (interface{}, error) {
+	if secret.Env == "" && secret.File == "" && secret.Command == "" && !secret.Prompt {
+		return secret.Value, nil
+	}
+
+	type rawSecret Secret
+	return rawSecret(secret), nil
+}
+
+// IsSet reports whether the secret has a value or a source
+func (secret Secret) IsSet() bool {
+	return secret != Secret{}
+}
+
+// Resolve reads the secret from its source. name describes the secret in prompts and errors.
+func (secret Secret) Resolve(name string) (string, error) {
+	switch {
+	case secret.Value != "":
+		return secret.Value, nil
+	case secret.Env != "":
+		value := os.Getenv(secret.Env)
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s for %s is not set", secret.Env, name)
+		}
+
+		return value, nil
+	case secret.File != "":
+		value, err := ioutil.ReadFile(secret.File)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %w", name, err)
+		}
+
+		return strings.TrimRight(string(value), "\r\n"), nil
+	case secret.Command != "":
+		return runSecretCommand(secret.Command, name)
+	case secret.Prompt:
+		return readPassword(fmt.Sprintf("%s: ", name))
+	}
+
+	return "", nil
+}
+
+// runSecretCommand runs a command such as `pass show vault` and returns the first line of its output
+func runSecretCommand(command string, name string) (string, error) {
+	output := bytes.Buffer{}
+	// The command gets no input, as kugo's stdin belongs to the wrapped executable, as in `cat pod.yaml | kugo apply -f -`.
+	// Commands which need to ask for something, such as a GPG passphrase, use the terminal.
+	secretCommand := shellCommand(command)
+	secretCommand.Stdout = &output
+	secretCommand.Stderr = os.Stderr
+
+	if err := secretCommand.Run(); err != nil {
+		return "", fmt.Errorf("command for %s failed: %w", name, err)
+	}
+
+	return strings.TrimRight(strings.SplitN(output.String(), "\n", 2)[0], "\r"), nil
+}
+
+// redacted returns a copy of the secret with its value replaced, keeping where it is read from
+func (secret Secret) redacted() Secret {
+	if secret.Value != "" {
+		secret.Value = redactedValue
+	}
+
+	return secret
+}
@@ -0,0 +1,136 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+var exampleSecretSourcesConfiguration = `
+vault_address: https://vault:8443
+vault_auth:
+  userpass:
+    username: kugo
+    password:
+      env: KUGO_TEST_PASSWORD
+profiles:
+  ci:
+    vault_auth_method: approle
+    vault_auth:
+      approle:
+        role_id: testRoleID
+        secret_id:
+          command: echo testSecretID
+  staging:
+    vault_auth:
+      userpass:
+        password: plaintext`
+
+func TestSecretSources(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleSecretSourcesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("KUGO_TEST_PASSWORD", "fromEnvironment")
+	defer os.Unsetenv("KUGO_TEST_PASSWORD")
+
+	password, err := configuration.VaultAuth.Userpass.Password.Resolve("password")
+	if err != nil || password != "fromEnvironment" {
+		t.Errorf("Read %q from the environment", password)
+	}
+
+	secretID, err := configuration.Profiles["ci"].VaultAuth.AppRole.SecretID.Resolve("secret ID")
+	if err != nil || secretID != "testSecretID" {
+		t.Errorf("Read %q from the command", secretID)
+	}
+
+	password, err = configuration.Profiles["staging"].VaultAuth.Userpass.Password.Resolve("password")
+	if err != nil || password != "plaintext" {
+		t.Errorf("Read %q from the configuration", password)
+	}
+
+	secretFile, err := ioutil.TempFile("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secretFile.Name())
+
+	secretFile.WriteString("fromFile\n")
+	secretFile.Close()
+
+	password, err = Secret{File: secretFile.Name()}.Resolve("password")
+	if err != nil || password != "fromFile" {
+		t.Errorf("Read %q from the file", password)
+	}
+
+	if _, err := (Secret{Env: "KUGO_TEST_UNSET"}).Resolve("password"); err == nil {
+		t.Error("Did not error on an unset environment variable")
+	}
+}
+
+func TestPlaintextSecretWarnings(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleSecretSourcesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configuration.Warnings) != 1 || !strings.Contains(configuration.Warnings[0], "profile staging") {
+		t.Errorf("Expected a warning about the staging password, got %q", configuration.Warnings)
+	}
+
+	configuration, err = ParseConfiguration([]byte(exampleProfilesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The legacy password is set once in the default profile, and the secret ID once in the staging profile
+	if len(configuration.Warnings) != 2 {
+		t.Errorf("Expected 2 warnings, got %q", configuration.Warnings)
+	}
+}
+
+func TestRedactedSecretSources(t *testing.T) {
+	configuration, err := ParseConfiguration([]byte(exampleSecretSourcesConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := configuration.MarshalRedacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(redacted), "plaintext") {
+		t.Error("Plaintext secret was not redacted")
+	}
+
+	if !strings.Contains(string(redacted), "env: KUGO_TEST_PASSWORD") || !strings.Contains(string(redacted), "command: echo testSecretID") {
+		t.Error("Secret sources were not shown")
+	}
+}
+
+func TestSecretCommandDoesNotReadStdin(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	writer.WriteString("inputForTheWrappedExecutable\n")
+	writer.Close()
+
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	value, err := Secret{Command: "cat"}.Resolve("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "" {
+		t.Errorf("Secret command read %q from stdin", value)
+	}
+}
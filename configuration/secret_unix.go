@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package configuration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// shellCommand runs a secret command with the user's shell syntax
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// readPassword prompts on the terminal and reads a line with echo turned off. The terminal is used directly, so that
+// prompting works when kugo's input and output are redirected.
+func readPassword(prompt string) (string, error) {
+	terminal, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to prompt on: %w", err)
+	}
+	defer terminal.Close()
+
+	stty := func(arguments ...string) error {
+		sttyCommand := exec.Command("stty", arguments...)
+		sttyCommand.Stdin = terminal
+		return sttyCommand.Run()
+	}
+
+	fmt.Fprint(terminal, prompt)
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("could not turn off terminal echo: %w", err)
+	}
+
+	// Echo is turned back on if the prompt is interrupted, as the terminal would otherwise be left without it
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupts:
+			stty("echo")
+			fmt.Fprintln(terminal)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		signal.Stop(interrupts)
+		close(done)
+		stty("echo")
+		fmt.Fprintln(terminal)
+	}()
+
+	line, err := bufio.NewReader(terminal).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
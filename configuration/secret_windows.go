@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package configuration
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// shellCommand runs a secret command with cmd.exe
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// readPassword isn't supported on Windows, as the console can't be read without echo using the standard library
+func readPassword(prompt string) (string, error) {
+	return "", errors.New("prompting for secrets is not supported on Windows, use env, file or command instead")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+	"github.com/bnmcg/kugo/logging"
+)
+
+const (
+	execCredentialAPIVersionV1Beta1 = "client.authentication.k8s.io/v1beta1"
+	execCredentialAPIVersionV1      = "client.authentication.k8s.io/v1"
+	execCredentialKind              = "ExecCredential"
+
+	// execInfoEnvironmentVariable is set by client-go when invoking an exec credential plugin
+	execInfoEnvironmentVariable = "KUBERNETES_EXEC_INFO"
+)
+
+// ExecCredentialStatus holds the credentials returned to the Kubernetes client
+type ExecCredentialStatus struct {
+	ExpirationTimestamp   string `json:"expirationTimestamp,omitempty"`
+	ClientCertificateData string `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string `json:"clientKeyData,omitempty"`
+}
+
+// ExecCredential is the object exchanged between a Kubernetes client and an exec credential plugin
+type ExecCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *ExecCredentialStatus `json:"status,omitempty"`
+}
+
+// NewExecCredential builds an ExecCredential from kubeconfig style credentials. The expiration timestamp is when the
+// certificate comes within the renewal threshold of its expiry, so the client calls the plugin again before it expires.
+// A certificate which is already within the threshold is rejected, as the client would never get to use it.
+func NewExecCredential(apiVersion string, credentials authentication.KubernetesCredentials, threshold RenewalThreshold) (ExecCredential, error) {
+	if apiVersion != execCredentialAPIVersionV1Beta1 && apiVersion != execCredentialAPIVersionV1 {
+		return ExecCredential{}, fmt.Errorf("unsupported ExecCredential API version %q", apiVersion)
+	}
+
+	certificate, err := DecodeBase64EncodedPEMCertificate(credentials.ClientCertificateData)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+
+	renewalTime := CertificateRenewalTime(certificate, threshold)
+	if !renewalTime.After(time.Now()) {
+		return ExecCredential{}, fmt.Errorf("certificate with serial %s is already due for renewal, kubernetes_pki_ttl must be longer than kubernetes_renewal_threshold", FormatSerialNumber(certificate.SerialNumber))
+	}
+
+	certificatePEM, err := base64.StdEncoding.DecodeString(credentials.ClientCertificateData)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(credentials.ClientKeyData)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+
+	return ExecCredential{
+		APIVersion: apiVersion,
+		Kind:       execCredentialKind,
+		Status: &ExecCredentialStatus{
+			ExpirationTimestamp:   renewalTime.UTC().Format(time.RFC3339),
+			ClientCertificateData: string(certificatePEM),
+			ClientKeyData:         string(keyPEM),
+		},
+	}, nil
+}
+
+// execCredentialAPIVersion determines which ExecCredential API version the calling client expects. client-go passes
+// this in KUBERNETES_EXEC_INFO, otherwise the version given on the command line is used.
+func execCredentialAPIVersion(fallback string) string {
+	execInfo := os.Getenv(execInfoEnvironmentVariable)
+	if execInfo == "" {
+		return fallback
+	}
+
+	request := ExecCredential{}
+	if err := json.Unmarshal([]byte(execInfo), &request); err != nil || request.APIVersion == "" {
+		return fallback
+	}
+
+	return request.APIVersion
+}
+
+// runCredentialPlugin writes credentials to output as an ExecCredential, allowing kugo to be referenced from the exec
+// section of a kubeconfig user. Every Kubernetes client calls the plugin, so credentials are cached and only issued
+// again once they need renewal.
+func runCredentialPlugin(arguments []string, kugoConfiguration configuration.KugoConfiguration, output io.Writer) error {
+	flags := flag.NewFlagSet("credential", flag.ContinueOnError)
+	username := flags.String("user", "", "Kubernetes username to request a certificate for (defaults to the user of the current context)")
+	contextName := flags.String("context", "", "Kubernetes context used to select a kugo profile (defaults to the current context)")
+	apiVersion := flags.String("api-version", execCredentialAPIVersionV1Beta1, "ExecCredential API version to return if the client does not specify one")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	kubeconfig, err := LoadKubeconfig(KubeconfigPaths())
+	if err != nil {
+		return err
+	}
+
+	context, user := resolveKubernetesSelection(kubeconfig, KubernetesSelection{Context: *contextName, User: *username})
+	if user.Name == "" {
+		// The user doesn't need to have an entry of its own when it's only referenced by the exec plugin
+		user.Name = *username
+	}
+
+	if user.Name == "" {
+		return errors.New("no user given and the selected context has no user")
+	}
+
+	renewalThreshold, err := ParseRenewalThreshold(kugoConfiguration.KubernetesRenewalThreshold)
+	if err != nil {
+		return err
+	}
+
+	profile := kugoConfiguration.ProfileFor(context.Name, context.Context.Cluster)
+	cachePath := credentialCachePath(authentication.DefaultTokenCacheDirectory(), profile, context, user)
+
+	credentials, ok := loadCachedCredentials(cachePath, renewalThreshold)
+	if !ok {
+		credentials, err = authenticate(profile, context, user)
+		if err != nil {
+			return err
+		}
+
+		if err := storeCachedCredentials(cachePath, credentials); err != nil {
+			logging.Debugf("Could not cache the Kubernetes credentials: %s", err)
+		}
+	}
+
+	execCredential, err := NewExecCredential(execCredentialAPIVersion(*apiVersion), credentials, renewalThreshold)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(output).Encode(execCredential)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+	"github.com/bnmcg/kugo/logging"
+)
+
+// credentialCachePath returns where the credential plugin keeps the credentials of a user. The path depends on
+// everything that decides which certificate is issued, so a change of profile or PKI role issues a new one.
+func credentialCachePath(directory string, profile configuration.Profile, context KubernetesContext, user KubernetesUser) string {
+	key := sha256.Sum256([]byte(strings.Join([]string{
+		profile.Name,
+		profile.VaultAddress,
+		profile.VaultPKINamespace,
+		profile.VaultPKIMount,
+		profile.VaultPKIRole,
+		context.Name,
+		user.Name,
+	}, "\n")))
+
+	return filepath.Join(directory, "credential-"+hex.EncodeToString(key[:8])+".json")
+}
+
+// loadCachedCredentials returns the cached credentials, if there are any which don't yet need renewal
+func loadCachedCredentials(cachePath string, threshold RenewalThreshold) (authentication.KubernetesCredentials, bool) {
+	credentialBytes, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Debugf("Could not read the cached Kubernetes credentials: %s", err)
+		}
+		return authentication.KubernetesCredentials{}, false
+	}
+
+	credentials := authentication.KubernetesCredentials{}
+	if err := json.Unmarshal(credentialBytes, &credentials); err != nil {
+		logging.Debugf("Could not parse the cached Kubernetes credentials: %s", err)
+		return authentication.KubernetesCredentials{}, false
+	}
+
+	certificate, err := DecodeBase64EncodedPEMCertificate(credentials.ClientCertificateData)
+	if err != nil {
+		logging.Debugf("Could not read the cached certificate: %s", err)
+		return authentication.KubernetesCredentials{}, false
+	}
+
+	if CertificateNeedsRenewal(certificate, threshold) {
+		logging.Debugf("Cached certificate with serial %s needs renewal", FormatSerialNumber(certificate.SerialNumber))
+		return authentication.KubernetesCredentials{}, false
+	}
+
+	logging.Debugf("Using the cached certificate with serial %s", FormatSerialNumber(certificate.SerialNumber))
+	return credentials, true
+}
+
+// storeCachedCredentials saves the credentials in a file only readable by its owner, as it holds the private key
+func storeCachedCredentials(cachePath string, credentials authentication.KubernetesCredentials) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return err
+	}
+
+	credentialBytes, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(cachePath, credentialBytes, 0)
+}
+
+// removeCachedCredentials deletes the cached credentials, if there are any
+func removeCachedCredentials(cachePath string) error {
+	err := os.Remove(cachePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bnmcg/kugo/authentication"
+)
+
+// explainError turns Vault failures, including ones wrapped in other errors, into messages which say what to do about
+// them. Other errors are returned unchanged.
+func explainError(err error) error {
+	var vaultError *authentication.VaultError
+	if !errors.As(err, &vaultError) {
+		return err
+	}
+
+	message := ""
+	switch vaultError.Kind {
+	case authentication.ErrPermissionDenied:
+		message = fmt.Sprintf("your policy does not allow %s, ask your Vault administrators for access", vaultError.Path)
+	case authentication.ErrRoleNotFound:
+		message = fmt.Sprintf("%s does not exist, check vault_pki_mount and vault_pki_role", vaultError.Path)
+	case authentication.ErrSealed:
+		message = "Vault is sealed, ask your Vault administrators to unseal it"
+	case authentication.ErrInvalidCredentials:
+		message = fmt.Sprintf("Vault rejected the credentials sent to %s, check the vault_auth settings", vaultError.Path)
+	case authentication.ErrMalformedResponse:
+		message = fmt.Sprintf("Vault sent an unexpected response from %s", vaultError.Path)
+	default:
+		return err
+	}
+
+	if len(vaultError.Messages) > 0 {
+		message = fmt.Sprintf("%s (%s)", message, vaultError.Messages[0])
+	}
+
+	if vaultError.RequestID != "" {
+		message = fmt.Sprintf("%s [Vault request ID %s]", message, vaultError.RequestID)
+	}
+
+	return fmt.Errorf("%s", message)
+}
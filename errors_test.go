@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bnmcg/kugo/authentication"
+)
+
+func TestExplainError(t *testing.T) {
+	err := explainError(&authentication.VaultError{
+		Kind:       authentication.ErrPermissionDenied,
+		Path:       "pki/issue/kugo-pki",
+		StatusCode: 403,
+		RequestID:  "4bc1f0d5",
+	})
+
+	if !strings.Contains(err.Error(), "your policy does not allow pki/issue/kugo-pki") {
+		t.Errorf("Permission denied was explained as %q", err)
+	}
+
+	if !strings.Contains(err.Error(), "4bc1f0d5") {
+		t.Error("Explanation did not include the request ID")
+	}
+
+	wrapped := fmt.Errorf("%w, check that the role allows the redirect URI", &authentication.VaultError{
+		Kind: authentication.ErrMalformedResponse,
+		Path: "auth/oidc/oidc/auth_url",
+	})
+	if !strings.Contains(explainError(wrapped).Error(), "Vault sent an unexpected response from auth/oidc/oidc/auth_url") {
+		t.Errorf("Wrapped error was explained as %q", explainError(wrapped))
+	}
+
+	other := errors.New("something else")
+	if explainError(other) != other {
+		t.Error("Other errors were changed")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock associated with filePath, blocking until it is available. A separate lock
+// file is used because the file itself is replaced when it is written.
+func lockFile(filePath string) (func() error, error) {
+	lock, err := os.OpenFile(filePath+".kugo-lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return func() error {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		return lock.Close()
+	}, nil
+}
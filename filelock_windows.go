@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package main
+
+// lockFile is a no-op on Windows, where kugo relies on the atomic rename alone
+func lockFile(filePath string) (func() error, error) {
+	return func() error { return nil }, nil
+}
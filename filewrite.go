@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultFileMode is used for files which don't exist yet, as kubeconfig files usually hold private keys
+const defaultFileMode os.FileMode = 0600
+
+// writeFileAtomically replaces the file at filePath with data by writing to a temporary file in the same directory and
+// renaming it into place, so readers never see a partially written file. The permissions of the existing file are kept
+// and up to backups previous versions are retained alongside it. If filePath is a symlink, the file it points to is
+// replaced and the link is left in place.
+func writeFileAtomically(filePath string, data []byte, backups int) error {
+	filePath, err := resolveSymlinks(filePath)
+	if err != nil {
+		return err
+	}
+
+	mode := defaultFileMode
+	existing, err := os.Stat(filePath)
+	if err == nil {
+		mode = existing.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	temporaryFile, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".kugo-")
+	if err != nil {
+		return err
+	}
+
+	temporaryPath := temporaryFile.Name()
+	defer os.Remove(temporaryPath)
+
+	if err := writeAndSync(temporaryFile, data, mode); err != nil {
+		return err
+	}
+
+	if existing != nil && backups > 0 {
+		if err := rotateBackups(filePath, backups, mode); err != nil {
+			return fmt.Errorf("could not back up %s: %w", filePath, err)
+		}
+	}
+
+	return os.Rename(temporaryPath, filePath)
+}
+
+// resolveSymlinks returns the file that filePath points to, or filePath itself if it doesn't exist yet
+func resolveSymlinks(filePath string) (string, error) {
+	resolvedPath, err := filepath.EvalSymlinks(filePath)
+	if os.IsNotExist(err) {
+		return filePath, nil
+	}
+
+	return resolvedPath, err
+}
+
+func writeAndSync(file *os.File, data []byte, mode os.FileMode) error {
+	defer file.Close()
+
+	if err := file.Chmod(mode); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// backupPath names the nth backup of a file, with 1 being the most recent
+func backupPath(filePath string, n int) string {
+	return fmt.Sprintf("%s.kugo-backup.%d", filePath, n)
+}
+
+// rotateBackups shifts existing backups of filePath along by one, discarding the oldest, and copies the current file
+// into the most recent backup
+func rotateBackups(filePath string, backups int, mode os.FileMode) error {
+	for n := backups - 1; n >= 1; n-- {
+		err := os.Rename(backupPath(filePath, n), backupPath(filePath, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	current, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(backupPath(filePath, 1), current, mode)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicallyKeepsPermissions(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "config")
+	if err := ioutil.WriteFile(filePath, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(filePath, 0640)
+
+	if err := writeFileAtomically(filePath, []byte("updated"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Permissions were not preserved, got %o", info.Mode().Perm())
+	}
+
+	contents, _ := ioutil.ReadFile(filePath)
+	if string(contents) != "updated" {
+		t.Error("File was not updated")
+	}
+}
+
+func TestWriteFileAtomicallyDefaultPermissions(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "config")
+	if err := writeFileAtomically(filePath, []byte("new"), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("New file was not private, got %o", info.Mode().Perm())
+	}
+
+	if _, err := os.Stat(backupPath(filePath, 1)); !os.IsNotExist(err) {
+		t.Error("Backup was created for a file which didn't exist")
+	}
+}
+
+func TestWriteFileAtomicallyRotatesBackups(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "config")
+	for _, contents := range []string{"one", "two", "three", "four"} {
+		if err := writeFileAtomically(filePath, []byte(contents), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[int]string{1: "three", 2: "two"}
+	for n, contents := range expected {
+		backup, err := ioutil.ReadFile(backupPath(filePath, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(backup) != contents {
+			t.Errorf("Backup %d contained %q, expected %q", n, backup, contents)
+		}
+	}
+
+	if _, err := os.Stat(backupPath(filePath, 3)); !os.IsNotExist(err) {
+		t.Error("More backups were kept than configured")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(directory, ".config.kugo-*"))
+	if len(files) != 0 {
+		t.Error("Temporary files were left behind")
+	}
+}
+
+func TestWriteFileAtomicallyFollowsSymlinks(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	targetPath := filepath.Join(directory, "dotfiles-config")
+	if err := ioutil.WriteFile(targetPath, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	linkPath := filepath.Join(directory, "config")
+	if err := os.Symlink(targetPath, linkPath); err != nil {
+		t.Skip("Symlinks are not supported:", err)
+	}
+
+	if err := writeFileAtomically(linkPath, []byte("updated"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Symlink was replaced with a regular file")
+	}
+
+	contents, _ := ioutil.ReadFile(targetPath)
+	if string(contents) != "updated" {
+		t.Errorf("Symlink target contained %q", contents)
+	}
+
+	backup, err := ioutil.ReadFile(backupPath(targetPath, 1))
+	if err != nil || string(backup) != "original" {
+		t.Errorf("Backup was not kept alongside the symlink target: %v", err)
+	}
+}
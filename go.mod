@@ -1,8 +1,9 @@
 module github.com/bnmcg/kugo
 
-go 1.12
+go 1.13
 
 require (
 	github.com/hashicorp/vault/api v1.0.2
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
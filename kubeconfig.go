@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/bnmcg/kugo/authentication"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 // KubernetesClusterIdentityInformation Identify a server based on IP and CA information
@@ -39,7 +44,8 @@ type KubernetesUser struct {
 	User authentication.KubernetesCredentials `yaml:"user"`
 }
 
-// KubernetesConfiguration represents .kube/config file
+// KubernetesConfiguration represents .kube/config file. Only the fields kugo reads are modelled, so updates are made
+// to the YAML document itself to avoid losing anything else in the file.
 type KubernetesConfiguration struct {
 	APIVersion     string              `yaml:"apiVersion"`
 	CurrentContext string              `yaml:"current-context"`
@@ -50,12 +56,56 @@ type KubernetesConfiguration struct {
 	Preferences    interface{}         `yaml:"preferences"`
 }
 
-// LoadKubeconfig from file and return the parsed configuration
-func LoadKubeconfig() (KubernetesConfiguration, error) {
-	homeDir := os.Getenv("HOME")
-	path := path.Join(homeDir, ".kube", "config")
+// KubeconfigPaths returns the kubeconfig files to use, following kubectl's handling of the KUBECONFIG environment
+// variable. When it isn't set, $HOME/.kube/config is used.
+func KubeconfigPaths() []string {
+	kubeconfigVariable := os.Getenv("KUBECONFIG")
+	if kubeconfigVariable == "" {
+		homeDir := os.Getenv("HOME")
+		return []string{path.Join(homeDir, ".kube", "config")}
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, kubeconfigPath := range filepath.SplitList(kubeconfigVariable) {
+		if kubeconfigPath == "" || seen[kubeconfigPath] {
+			continue
+		}
+
+		seen[kubeconfigPath] = true
+		paths = append(paths, kubeconfigPath)
+	}
+
+	return paths
+}
+
+// LoadKubeconfig loads every given file and merges them the way kubectl does. Files which don't exist are skipped,
+// unless none of the files exist.
+func LoadKubeconfig(paths []string) (KubernetesConfiguration, error) {
+	configs := []KubernetesConfiguration{}
+	for _, kubeconfigPath := range paths {
+		config, err := LoadKubeconfigFile(kubeconfigPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return KubernetesConfiguration{}, fmt.Errorf("could not load kubeconfig %s: %w", kubeconfigPath, err)
+		}
 
-	kubeconfigBytes, err := ioutil.ReadFile(path)
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 0 {
+		return KubernetesConfiguration{}, fmt.Errorf("no kubeconfig found in %s", strings.Join(paths, string(filepath.ListSeparator)))
+	}
+
+	return MergeKubeconfigs(configs...), nil
+}
+
+// LoadKubeconfigFile from a single file and return the parsed configuration
+func LoadKubeconfigFile(kubeconfigPath string) (KubernetesConfiguration, error) {
+	kubeconfigBytes, err := ioutil.ReadFile(kubeconfigPath)
 	if err != nil {
 		return KubernetesConfiguration{}, err
 	}
@@ -63,6 +113,56 @@ func LoadKubeconfig() (KubernetesConfiguration, error) {
 	return ParseKubeconfig(kubeconfigBytes)
 }
 
+// MergeKubeconfigs combines several configurations using kubectl's rules: the first file to define a cluster, context or
+// user wins, as does the first file to set the current context
+func MergeKubeconfigs(configs ...KubernetesConfiguration) KubernetesConfiguration {
+	merged := KubernetesConfiguration{}
+	clusters := map[string]bool{}
+	contexts := map[string]bool{}
+	users := map[string]bool{}
+
+	for _, config := range configs {
+		if merged.APIVersion == "" {
+			merged.APIVersion = config.APIVersion
+		}
+
+		if merged.Kind == "" {
+			merged.Kind = config.Kind
+		}
+
+		if merged.CurrentContext == "" {
+			merged.CurrentContext = config.CurrentContext
+		}
+
+		if merged.Preferences == nil {
+			merged.Preferences = config.Preferences
+		}
+
+		for _, cluster := range config.Clusters {
+			if !clusters[cluster.Name] {
+				clusters[cluster.Name] = true
+				merged.Clusters = append(merged.Clusters, cluster)
+			}
+		}
+
+		for _, context := range config.Contexts {
+			if !contexts[context.Name] {
+				contexts[context.Name] = true
+				merged.Contexts = append(merged.Contexts, context)
+			}
+		}
+
+		for _, user := range config.Users {
+			if !users[user.Name] {
+				users[user.Name] = true
+				merged.Users = append(merged.Users, user)
+			}
+		}
+	}
+
+	return merged
+}
+
 // ParseKubeconfig into struct
 func ParseKubeconfig(config []byte) (KubernetesConfiguration, error) {
 	kubeConfig := KubernetesConfiguration{}
@@ -75,19 +175,351 @@ func ParseKubeconfig(config []byte) (KubernetesConfiguration, error) {
 	return kubeConfig, nil
 }
 
-// WriteKubeconfig writes the given configuration to $HOME/.kube/config
-func WriteKubeconfig(newConfig KubernetesConfiguration) error {
-	serializedConfig, err := yaml.Marshal(newConfig)
+// UpdateKubeconfigUsers replaces the credentials of the given users. Each user is written back to the file which
+// defines it, rather than to a merged copy of the configuration. Files are locked while they're updated, and up to
+// backups previous versions of each modified file are kept.
+func UpdateKubeconfigUsers(paths []string, credentials map[string]authentication.KubernetesCredentials, backups int) error {
+	remaining := map[string]authentication.KubernetesCredentials{}
+	for name, userCredentials := range credentials {
+		remaining[name] = userCredentials
+	}
+
+	for _, kubeconfigPath := range paths {
+		if len(remaining) == 0 {
+			break
+		}
+
+		if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
+			continue
+		}
+
+		err := updateKubeconfigFileUsers(kubeconfigPath, remaining, backups)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range remaining {
+		return fmt.Errorf("user %s is not defined in any kubeconfig", name)
+	}
+
+	return nil
+}
+
+// updateKubeconfigFileUsers updates any of the given users which are defined in a single kubeconfig file, removing them
+// from credentials once they've been written
+func updateKubeconfigFileUsers(kubeconfigPath string, credentials map[string]authentication.KubernetesCredentials, backups int) error {
+	// The lock is taken on the file a symlinked kubeconfig points to, as that is the file which gets replaced
+	kubeconfigPath, err := resolveSymlinks(kubeconfigPath)
 	if err != nil {
 		return err
 	}
 
-	home := os.Getenv("HOME")
-	configPath := path.Join(home, ".kube", "config")
-	err = ioutil.WriteFile(configPath, serializedConfig, 0644)
+	unlock, err := lockFile(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("could not lock kubeconfig %s: %w", kubeconfigPath, err)
+	}
+	defer unlock()
+
+	kubeconfigBytes, err := ioutil.ReadFile(kubeconfigPath)
 	if err != nil {
 		return err
 	}
 
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(kubeconfigBytes, &document); err != nil {
+		return fmt.Errorf("could not parse kubeconfig %s: %w", kubeconfigPath, err)
+	}
+
+	updated := map[*yaml.Node]authentication.KubernetesCredentials{}
+	for _, user := range kubeconfigUserNodes(&document) {
+		name := mappingValue(user, "name")
+		if name == nil {
+			continue
+		}
+
+		userCredentials, ok := credentials[name.Value]
+		if !ok {
+			continue
+		}
+
+		updated[user] = userCredentials
+		delete(credentials, name.Value)
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+
+	// Only the credentials are edited in place where possible, so the rest of the file stays byte for byte as it was.
+	// Layouts which can't be edited in place, such as `user: {}`, are written out again in full.
+	serializedConfig, ok := editKubeconfigCredentials(kubeconfigBytes, updated)
+	if !ok {
+		for user, userCredentials := range updated {
+			setUserCredentials(user, userCredentials)
+		}
+
+		serializedConfig, err = encodeKubeconfigDocument(&document)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomically(kubeconfigPath, serializedConfig, backups)
+}
+
+// credentialFields pairs the kubeconfig keys of a user's credentials with their new values
+func credentialFields(credentials authentication.KubernetesCredentials) [][2]string {
+	return [][2]string{
+		{"client-certificate-data", credentials.ClientCertificateData},
+		{"client-key-data", credentials.ClientKeyData},
+	}
+}
+
+// editKubeconfigCredentials rewrites the credential values of the given users in the kubeconfig's source text, adding
+// missing keys above the user's first key. It returns false if a user's layout can't be edited safely in place.
+func editKubeconfigCredentials(source []byte, updated map[*yaml.Node]authentication.KubernetesCredentials) ([]byte, bool) {
+	replacements := map[int]*yaml.Node{}
+	replacementValues := map[int]string{}
+	insertions := map[int][]string{}
+
+	for user, credentials := range updated {
+		userDetails := mappingValue(user, "user")
+		if userDetails == nil || userDetails.Kind != yaml.MappingNode || userDetails.Style&yaml.FlowStyle != 0 || len(userDetails.Content) == 0 {
+			return nil, false
+		}
+
+		for _, field := range credentialFields(credentials) {
+			value := mappingValue(userDetails, field[0])
+			if value == nil {
+				firstKey := userDetails.Content[0]
+				line := strings.Repeat(" ", firstKey.Column-1) + field[0] + ": " + yamlScalar(field[1])
+				insertions[firstKey.Line] = append(insertions[firstKey.Line], line)
+				continue
+			}
+
+			if !editableScalar(value) || replacements[value.Line] != nil {
+				return nil, false
+			}
+
+			replacements[value.Line] = value
+			replacementValues[value.Line] = field[1]
+		}
+	}
+
+	lines := strings.SplitAfter(string(source), "\n")
+	edited := strings.Builder{}
+	for index, line := range lines {
+		lineNumber := index + 1
+		lineEnding := ""
+		for _, ending := range []string{"\r\n", "\n"} {
+			if strings.HasSuffix(line, ending) {
+				lineEnding = ending
+				line = strings.TrimSuffix(line, ending)
+				break
+			}
+		}
+
+		for _, inserted := range insertions[lineNumber] {
+			edited.WriteString(inserted + lineEndingOrNewline(lineEnding))
+		}
+
+		if value := replacements[lineNumber]; value != nil {
+			replaced, ok := replaceScalar(line, value, replacementValues[lineNumber])
+			if !ok {
+				return nil, false
+			}
+			line = replaced
+		}
+
+		edited.WriteString(line + lineEnding)
+	}
+
+	// The edited text must mean the same as the edited document, otherwise it's written out in full instead
+	editedDocument := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(edited.String()), &editedDocument); err != nil {
+		return nil, false
+	}
+
+	for _, user := range kubeconfigUserNodes(&editedDocument) {
+		name := mappingValue(user, "name")
+		for original, credentials := range updated {
+			if name == nil || name.Value != mappingValue(original, "name").Value {
+				continue
+			}
+
+			for _, field := range credentialFields(credentials) {
+				value := mappingValue(mappingValue(user, "user"), field[0])
+				if value == nil || value.Value != field[1] {
+					return nil, false
+				}
+			}
+		}
+	}
+
+	return []byte(edited.String()), true
+}
+
+func lineEndingOrNewline(lineEnding string) string {
+	if lineEnding == "" {
+		return "\n"
+	}
+
+	return lineEnding
+}
+
+// editableScalar checks that a value is a single line scalar, which can be replaced without reflowing the file
+func editableScalar(value *yaml.Node) bool {
+	if value.Kind != yaml.ScalarNode || value.Anchor != "" || value.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) != 0 {
+		return false
+	}
+
+	// An empty plain value has no text of its own to replace
+	if value.Value == "" && value.Style == 0 {
+		return false
+	}
+
+	return !strings.ContainsAny(value.Value, " \t\r\n")
+}
+
+// replaceScalar replaces the scalar starting at the value's column with a new value, keeping anything after it on the
+// line, such as a comment
+func replaceScalar(line string, value *yaml.Node, newValue string) (string, bool) {
+	characters := []rune(line)
+	start := value.Column - 1
+	if start < 0 || start >= len(characters) {
+		return "", false
+	}
+
+	end := -1
+	switch {
+	case value.Style&yaml.SingleQuotedStyle != 0:
+		for index := start + 1; index < len(characters); index++ {
+			if characters[index] == '\'' {
+				if index+1 < len(characters) && characters[index+1] == '\'' {
+					index++
+					continue
+				}
+				end = index + 1
+				break
+			}
+		}
+	case value.Style&yaml.DoubleQuotedStyle != 0:
+		for index := start + 1; index < len(characters); index++ {
+			if characters[index] == '\\' {
+				index++
+				continue
+			}
+			if characters[index] == '"' {
+				end = index + 1
+				break
+			}
+		}
+	default:
+		end = start + len([]rune(value.Value))
+		if end > len(characters) || string(characters[start:end]) != value.Value {
+			return "", false
+		}
+	}
+
+	if end < 0 {
+		return "", false
+	}
+
+	return string(characters[:start]) + yamlScalar(newValue) + string(characters[end:]), true
+}
+
+// yamlScalar formats a credential value, which is written plain when it's base64 that YAML reads back as a string
+func yamlScalar(value string) string {
+	if value == "" || strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=") != "" {
+		return strconv.Quote(value)
+	}
+
+	plain := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(value), &plain); err != nil || len(plain.Content) == 0 || plain.Content[0].Tag != "!!str" {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+// kubeconfigUserNodes returns the mapping node of each entry in the users list of a kubeconfig document
+func kubeconfigUserNodes(document *yaml.Node) []*yaml.Node {
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 {
+		return nil
+	}
+
+	users := mappingValue(document.Content[0], "users")
+	if users == nil || users.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	userNodes := []*yaml.Node{}
+	for _, user := range users.Content {
+		if user.Kind == yaml.MappingNode {
+			userNodes = append(userNodes, user)
+		}
+	}
+
+	return userNodes
+}
+
+// setUserCredentials replaces the client certificate and key of a kubeconfig user entry, leaving every other field,
+// comment and the order of keys as they were
+func setUserCredentials(user *yaml.Node, credentials authentication.KubernetesCredentials) {
+	userDetails := mappingValue(user, "user")
+	if userDetails == nil || userDetails.Kind != yaml.MappingNode {
+		userDetails = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setMappingValue(user, "user", userDetails)
+	}
+
+	setMappingValue(userDetails, "client-certificate-data", stringNode(credentials.ClientCertificateData))
+	setMappingValue(userDetails, "client-key-data", stringNode(credentials.ClientKeyData))
+}
+
+// mappingValue finds the value for a key in a mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			return mapping.Content[index+1]
+		}
+	}
+
 	return nil
 }
+
+// setMappingValue replaces the value for a key in a mapping node, appending the key if it doesn't exist
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			value.LineComment = mapping.Content[index+1].LineComment
+			mapping.Content[index+1] = value
+			return
+		}
+	}
+
+	mapping.Content = append(mapping.Content, stringNode(key), value)
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func encodeKubeconfigDocument(document *yaml.Node) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
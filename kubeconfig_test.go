@@ -1,6 +1,15 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bnmcg/kugo/authentication"
+)
 
 var exampleSingleClusterConfiguration = `
 apiVersion: v1
@@ -211,3 +220,326 @@ func validateUser(user KubernetesUser, t *testing.T, expectedName string, expect
 		t.Error("Incorrect user key data parsed!")
 	}
 }
+
+var exampleSecondFileConfiguration = `
+apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: testCertificateAuthorityOverride
+    server: https://127.0.0.3:6443
+  name: kubernetes
+- cluster:
+    certificate-authority-data: testCertificateAuthority3
+    server: https://127.0.0.4:6443
+  name: kubernetes3
+contexts:
+- context:
+    cluster: kubernetes3
+    user: kubernetes-admin3
+  name: kubernetes-admin3@kubernetes3
+current-context: kubernetes-admin3@kubernetes3
+kind: Config
+preferences: {}
+users:
+- name: kubernetes-admin3
+  user:
+    client-certificate-data: testClientCertificateData3
+    client-key-data: testClientKeyData3`
+
+func TestKubeconfigPathsDefault(t *testing.T) {
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+
+	os.Unsetenv("KUBECONFIG")
+	os.Setenv("HOME", "/home/kugo")
+
+	paths := KubeconfigPaths()
+	if len(paths) != 1 || paths[0] != "/home/kugo/.kube/config" {
+		t.Error("Did not default to $HOME/.kube/config")
+	}
+}
+
+func TestKubeconfigPathsFromEnvironment(t *testing.T) {
+	os.Setenv("KUBECONFIG", "/tmp/a::/tmp/b:/tmp/a")
+	defer os.Unsetenv("KUBECONFIG")
+
+	paths := KubeconfigPaths()
+	if len(paths) != 2 || paths[0] != "/tmp/a" || paths[1] != "/tmp/b" {
+		t.Errorf("Incorrect kubeconfig paths %v", paths)
+	}
+}
+
+func TestKubeconfigMerging(t *testing.T) {
+	first, err := ParseKubeconfig([]byte(exampleSingleClusterConfiguration))
+	if err != nil {
+		t.Error(err)
+	}
+
+	second, err := ParseKubeconfig([]byte(exampleSecondFileConfiguration))
+	if err != nil {
+		t.Error(err)
+	}
+
+	merged := MergeKubeconfigs(first, second)
+
+	if merged.CurrentContext != "kubernetes-admin@kubernetes" {
+		t.Error("Current context was not taken from the first file")
+	}
+
+	if len(merged.Clusters) != 2 || len(merged.Contexts) != 2 || len(merged.Users) != 2 {
+		t.Error("Incorrect number of merged entries")
+	}
+
+	validateCluster(merged.Clusters[0], t, "testCertificateAuthority", "https://127.0.0.1:6443", "kubernetes")
+	validateCluster(merged.Clusters[1], t, "testCertificateAuthority3", "https://127.0.0.4:6443", "kubernetes3")
+	validateUser(merged.Users[1], t, "kubernetes-admin3", "testClientCertificateData3", "testClientKeyData3")
+}
+
+func TestLoadKubeconfigSkipsMissingFiles(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleSingleClusterConfiguration)
+	defer os.RemoveAll(directory)
+
+	config, err := LoadKubeconfig([]string{filepath.Join(directory, "missing"), filepath.Join(directory, "config0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Users) != 1 {
+		t.Error("Incorrect number of users loaded")
+	}
+
+	_, err = LoadKubeconfig([]string{filepath.Join(directory, "missing")})
+	if err == nil {
+		t.Error("Did not error when no kubeconfig exists")
+	}
+}
+
+func TestUpdateKubeconfigUsersWritesDefiningFile(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleSingleClusterConfiguration, exampleSecondFileConfiguration)
+	defer os.RemoveAll(directory)
+
+	paths := []string{filepath.Join(directory, "config0"), filepath.Join(directory, "config1")}
+	err := UpdateKubeconfigUsers(paths, map[string]authentication.KubernetesCredentials{
+		"kubernetes-admin3": {ClientCertificateData: "newCertificateData", ClientKeyData: "newKeyData"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := LoadKubeconfigFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first.Users) != 1 {
+		t.Error("User was written to the wrong file")
+	}
+
+	validateUser(first.Users[0], t, "kubernetes-admin", "testClientCertificateData", "testClientKeyData")
+
+	second, err := LoadKubeconfigFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateUser(second.Users[0], t, "kubernetes-admin3", "newCertificateData", "newKeyData")
+}
+
+func TestUpdateKubeconfigUsersUnknownUser(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleSingleClusterConfiguration)
+	defer os.RemoveAll(directory)
+
+	err := UpdateKubeconfigUsers([]string{filepath.Join(directory, "config0")}, map[string]authentication.KubernetesCredentials{
+		"nobody": {},
+	}, 0)
+	if err == nil {
+		t.Error("Did not error on unknown user")
+	}
+}
+
+func writeTestKubeconfigs(t *testing.T, configs ...string) string {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, config := range configs {
+		kubeconfigPath := filepath.Join(directory, fmt.Sprintf("config%d", index))
+		if err := ioutil.WriteFile(kubeconfigPath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return directory
+}
+
+var exampleConfigurationWithUnmodelledFields = `# Managed by kugo
+apiVersion: v1
+clusters:
+- cluster:
+    server: https://127.0.0.1:6443
+    insecure-skip-tls-verify: true
+    proxy-url: http://proxy:3128
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    namespace: kube-system
+    user: kubernetes-admin
+  name: kubernetes-admin@kubernetes
+current-context: kubernetes-admin@kubernetes
+kind: Config
+preferences: {}
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: testClientCertificateData # refreshed by kugo
+    client-key-data: testClientKeyData
+- name: token-user
+  user:
+    token: testToken
+extensions:
+- name: example
+  extension:
+    key: value`
+
+func TestUpdateKubeconfigUsersPreservesUnmodelledFields(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleConfigurationWithUnmodelledFields)
+	defer os.RemoveAll(directory)
+
+	kubeconfigPath := filepath.Join(directory, "config0")
+	err := UpdateKubeconfigUsers([]string{kubeconfigPath}, map[string]authentication.KubernetesCredentials{
+		"kubernetes-admin": {ClientCertificateData: "newCertificateData", ClientKeyData: "newKeyData"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubeconfigBytes, err := ioutil.ReadFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := string(kubeconfigBytes)
+	for _, expected := range []string{
+		"# Managed by kugo",
+		"insecure-skip-tls-verify: true",
+		"proxy-url: http://proxy:3128",
+		"namespace: kube-system",
+		"token: testToken",
+		"key: value",
+		"client-certificate-data: newCertificateData # refreshed by kugo",
+		"client-key-data: newKeyData",
+	} {
+		if !strings.Contains(updated, expected) {
+			t.Errorf("Updated kubeconfig is missing %q", expected)
+		}
+	}
+
+	if strings.Index(updated, "clusters:") > strings.Index(updated, "users:") {
+		t.Error("Order of keys was not preserved")
+	}
+}
+
+func TestUpdateKubeconfigUsersAddsMissingCredentials(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleConfigurationWithUnmodelledFields)
+	defer os.RemoveAll(directory)
+
+	kubeconfigPath := filepath.Join(directory, "config0")
+	err := UpdateKubeconfigUsers([]string{kubeconfigPath}, map[string]authentication.KubernetesCredentials{
+		"token-user": {ClientCertificateData: "newCertificateData", ClientKeyData: "newKeyData"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadKubeconfigFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateUser(config.Users[1], t, "token-user", "newCertificateData", "newKeyData")
+}
+
+// exampleKubectlLayoutConfiguration is laid out the way kubectl writes kubeconfig files, with list items at the same
+// indentation as their parent key
+var exampleKubectlLayoutConfiguration = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: testCertificateAuthorityData
+    server: https://127.0.0.1:6443
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    user: kubernetes-admin
+  name: kubernetes-admin@kubernetes
+current-context: kubernetes-admin@kubernetes
+kind: Config
+preferences: {}
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: testClientCertificateData
+    client-key-data: 'testClientKeyData'   # quoted by hand
+- name: token-user
+  user:
+    token: testToken
+`
+
+func TestUpdateKubeconfigUsersOnlyChangesCredentials(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleKubectlLayoutConfiguration)
+	defer os.RemoveAll(directory)
+
+	kubeconfigPath := filepath.Join(directory, "config0")
+	err := UpdateKubeconfigUsers([]string{kubeconfigPath}, map[string]authentication.KubernetesCredentials{
+		"kubernetes-admin": {ClientCertificateData: "bmV3Q2VydGlmaWNhdGU=", ClientKeyData: "bmV3S2V5"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubeconfigBytes, err := ioutil.ReadFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.NewReplacer(
+		"client-certificate-data: testClientCertificateData", "client-certificate-data: bmV3Q2VydGlmaWNhdGU=",
+		"client-key-data: 'testClientKeyData'", "client-key-data: bmV3S2V5",
+	).Replace(exampleKubectlLayoutConfiguration)
+
+	if string(kubeconfigBytes) != expected {
+		t.Errorf("Kubeconfig changed beyond the credentials:\n%s", kubeconfigBytes)
+	}
+}
+
+func TestUpdateKubeconfigUsersInsertsCredentialsInPlace(t *testing.T) {
+	directory := writeTestKubeconfigs(t, exampleKubectlLayoutConfiguration)
+	defer os.RemoveAll(directory)
+
+	kubeconfigPath := filepath.Join(directory, "config0")
+	for _, credentials := range []authentication.KubernetesCredentials{
+		{ClientCertificateData: "bmV3Q2VydGlmaWNhdGU=", ClientKeyData: "bmV3S2V5"},
+		// Removing the credentials leaves empty values, which are replaced in place again on the next refresh
+		{},
+		{ClientCertificateData: "MTIzNA==", ClientKeyData: "1234"},
+	} {
+		err := UpdateKubeconfigUsers([]string{kubeconfigPath}, map[string]authentication.KubernetesCredentials{"token-user": credentials}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kubeconfigBytes, err := ioutil.ReadFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Replace(exampleKubectlLayoutConfiguration, "    token: testToken\n",
+		"    client-certificate-data: MTIzNA==\n    client-key-data: \"1234\"\n    token: testToken\n", 1)
+
+	if string(kubeconfigBytes) != expected {
+		t.Errorf("Kubeconfig changed beyond the credentials:\n%s", kubeconfigBytes)
+	}
+}
@@ -1,97 +1,251 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/bnmcg/kugo/authentication"
 	"github.com/bnmcg/kugo/configuration"
+	"github.com/bnmcg/kugo/logging"
+	"github.com/hashicorp/vault/api"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
-	executable := flag.String("executable", "kubectl", "Command to execute")
-	flag.Parse()
-	executableProvided := false
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "executable" {
-			executableProvided = true
-		}
-	})
+	err := runCommandLine(os.Args[1:])
+	if code, ok := err.(exitCodeError); ok {
+		os.Exit(int(code))
+	}
+
+	if err != nil {
+		log.Fatal(explainError(err))
+	}
+}
+
+// loadConfiguration reads .kugo.yaml and applies its logging settings
+func loadConfiguration() (configuration.KugoConfiguration, error) {
+	kugoConfiguration, err := configuration.LoadConfiguration()
+	if err != nil {
+		return configuration.KugoConfiguration{}, err
+	}
+
+	err = logging.Configure(kugoConfiguration.LogLevel, kugoConfiguration.LogFile)
+	if err != nil {
+		return configuration.KugoConfiguration{}, err
+	}
+
+	for _, warning := range kugoConfiguration.Warnings {
+		logging.Warnf("%s", warning)
+	}
+
+	return kugoConfiguration, nil
+}
+
+// loadSelectedKubeconfig loads the kubeconfig chosen by the selection, or the default kubeconfig files
+func loadSelectedKubeconfig(selection KubernetesSelection) ([]string, KubernetesConfiguration, error) {
+	kubeconfigPaths := KubeconfigPaths()
+	if selection.Kubeconfig != "" {
+		kubeconfigPaths = []string{selection.Kubeconfig}
+	}
+
+	logging.Tracef("Loading kubeconfig from %s", strings.Join(kubeconfigPaths, string(filepath.ListSeparator)))
+	kubeconfig, err := LoadKubeconfig(kubeconfigPaths)
+	if err != nil {
+		return nil, KubernetesConfiguration{}, err
+	}
+
+	return kubeconfigPaths, kubeconfig, nil
+}
 
-	configuration, err := configuration.LoadConfiguration()
+// refreshCredentials renews the credentials of the selected user if they need renewal, or unconditionally if force is
+// set, writing them back to the kubeconfig
+func refreshCredentials(kugoConfiguration configuration.KugoConfiguration, selection KubernetesSelection, force bool) error {
+	renewalThreshold, err := ParseRenewalThreshold(kugoConfiguration.KubernetesRenewalThreshold)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Parse existing k8s configuration
-	kubeconfig, err := LoadKubeconfig()
+	kubeconfigPaths, kubeconfig, err := loadSelectedKubeconfig(selection)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	currentContext, currentUser := resolveKubernetesSelection(kubeconfig, selection)
+	if currentUser.Name == "" {
+		return fmt.Errorf("could not find the user of context %q", currentContext.Name)
 	}
 
-	// Get current context
-	var currentContext KubernetesContext
+	profile := kugoConfiguration.ProfileFor(currentContext.Name, currentContext.Context.Cluster)
+	logging.Debugf("Using context %q, user %q and profile %q", currentContext.Name, currentUser.Name, profile.Name)
+
+	if currentUser.User.ClientCertificateData == "" {
+		logging.Debugf("Not refreshing context %q, its user is not managed by kugo", currentContext.Name)
+		return nil
+	}
+
+	needsRenewal := force
+	currentCertificate, err := DecodeBase64EncodedPEMCertificate(currentUser.User.ClientCertificateData)
+	if err != nil {
+		logging.Debugf("Could not read the current certificate: %s", err)
+		needsRenewal = true
+	} else {
+		logging.Debugf("Current certificate has serial %s and expires at %s", FormatSerialNumber(currentCertificate.SerialNumber), currentCertificate.NotAfter.Format(time.RFC3339))
+		needsRenewal = needsRenewal || CertificateNeedsRenewal(currentCertificate, renewalThreshold)
+	}
+
+	if !needsRenewal {
+		logging.Infof("Current Kubernetes credentials are still valid")
+		return nil
+	}
+
+	newCredentials, err := authenticate(profile, currentContext, currentUser)
+	if err != nil {
+		return err
+	}
+
+	err = UpdateKubeconfigUsers(kubeconfigPaths, map[string]authentication.KubernetesCredentials{
+		currentUser.Name: newCredentials,
+	}, kugoConfiguration.KubeconfigBackups)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Refreshed Kubernetes credentials...")
+	return nil
+}
+
+// resolveKubernetesSelection finds the context and user chosen on the command line. If no context is selected, the
+// current context is used, and if no user is selected the context's user is used.
+func resolveKubernetesSelection(kubeconfig KubernetesConfiguration, selection KubernetesSelection) (KubernetesContext, KubernetesUser) {
+	contextName := selection.Context
+	if contextName == "" {
+		contextName = kubeconfig.CurrentContext
+	}
+
+	selectedContext := KubernetesContext{}
 	for _, context := range kubeconfig.Contexts {
-		if context.Name == kubeconfig.CurrentContext {
-			currentContext = context
+		if context.Name == contextName {
+			selectedContext = context
 			break
 		}
 	}
 
-	// Get current user
-	var currentUser KubernetesUser
-	var currentUserIndex int
-	for index, user := range kubeconfig.Users {
-		if user.Name == currentContext.Context.User {
-			currentUser = user
-			currentUserIndex = index
-			break
+	username := selection.User
+	if username == "" {
+		username = selectedContext.Context.User
+	}
+
+	for _, user := range kubeconfig.Users {
+		if user.Name == username {
+			return selectedContext, user
 		}
 	}
 
-	currentCertificate, err := DecodeBase64EncodedPEMCertificate(currentUser.User.ClientCertificateData)
+	return selectedContext, KubernetesUser{}
+}
+
+// newVaultAuthenticator creates an authenticator which issues credentials for the given user using the profile's settings
+func newVaultAuthenticator(profile configuration.Profile, context KubernetesContext, user KubernetesUser) (*authentication.VaultAuthenticator, error) {
+	commonName, err := profile.CommonName(configuration.CommonNameData{
+		User:    user.Name,
+		Context: context.Name,
+		Cluster: context.Context.Cluster,
+	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("invalid common name template in profile %s: %w", profile.Name, err)
 	}
 
-	if CertificateHasExpired(currentCertificate) {
-		authenticator := authentication.VaultAuthenticator{
-			Address:            configuration.VaultAddress,
-			PKIMount:           configuration.VaultPKIMount,
-			PKIRole:            configuration.VaultPKIRole,
-			KubernetesUsername: currentUser.Name,
-			KubernetesTTL:      configuration.KubernetesPKITTL,
-		}
-		newCredentials, err := authenticator.AuthenticateWithUsernamePassword(configuration.VaultUsername, configuration.VaultPassword)
-		if err != nil {
-			log.Fatal(err)
-		}
+	authenticator := &authentication.VaultAuthenticator{
+		Address: profile.VaultAddress,
+		TLS: api.TLSConfig{
+			CACert:        profile.VaultTLS.CACert,
+			CAPath:        profile.VaultTLS.CAPath,
+			ClientCert:    profile.VaultTLS.ClientCert,
+			ClientKey:     profile.VaultTLS.ClientKey,
+			TLSServerName: profile.VaultTLS.TLSServerName,
+			Insecure:      profile.VaultTLS.Insecure,
+		},
+		AuthNamespace:      profile.VaultAuthNamespace,
+		PKINamespace:       profile.VaultPKINamespace,
+		PKIMount:           profile.VaultPKIMount,
+		PKIRole:            profile.VaultPKIRole,
+		PKIMode:            profile.VaultPKIMode,
+		KeyType:            profile.VaultPKIKeyType,
+		KubernetesUsername: commonName,
+		KubernetesTTL:      profile.KubernetesPKITTL,
+	}
+
+	// The cert method's certificate is presented by the connection to Vault
+	if profile.VaultAuthMethod == configuration.AuthMethodCert && profile.VaultAuth.Cert.ClientCert != "" {
+		authenticator.TLS.ClientCert = profile.VaultAuth.Cert.ClientCert
+		authenticator.TLS.ClientKey = profile.VaultAuth.Cert.ClientKey
+	}
 
-		kubeconfig.Users[currentUserIndex].User = newCredentials
-		err = WriteKubeconfig(kubeconfig)
+	authenticator.TokenCache = tokenCache(profile)
 
-		if err != nil {
-			log.Fatal(err)
-		}
+	return authenticator, nil
+}
 
-		fmt.Println("[kugo] Refreshed Kubernetes credentials...")
-	} else {
-		fmt.Println("[kugo] Current Kubernetes credentials are still valid")
+// authenticate retrieves new Kubernetes credentials for the given user from Vault, using the profile's settings
+func authenticate(profile configuration.Profile, context KubernetesContext, user KubernetesUser) (authentication.KubernetesCredentials, error) {
+	loginMethod := deferredLoginMethod(profile)
+
+	authenticator, err := newVaultAuthenticator(profile, context, user)
+	if err != nil {
+		return authentication.KubernetesCredentials{}, err
+	}
+
+	credentials, err := authenticator.Authenticate(loginMethod)
+	if err != nil {
+		return authentication.KubernetesCredentials{}, err
+	}
+
+	logIssuedCertificate(authenticator.KubernetesUsername, credentials)
+	return credentials, nil
+}
+
+// loginToVault logs in to Vault using the profile's login method and returns the token, so that it may be used for
+// several issuances
+func loginToVault(profile configuration.Profile, context KubernetesContext, user KubernetesUser) (string, error) {
+	loginMethod := deferredLoginMethod(profile)
+
+	authenticator, err := newVaultAuthenticator(profile, context, user)
+	if err != nil {
+		return "", err
 	}
 
-	arguments := os.Args[1:]
-	if executableProvided {
-		arguments = os.Args[2:]
+	auth, err := authenticator.Login(loginMethod)
+	if err != nil {
+		return "", err
+	}
+
+	return auth.ClientToken, nil
+}
+
+// issueWithToken retrieves new Kubernetes credentials for the given user from Vault using an existing Vault token
+func issueWithToken(profile configuration.Profile, context KubernetesContext, user KubernetesUser, token string) (authentication.KubernetesCredentials, error) {
+	authenticator, err := newVaultAuthenticator(profile, context, user)
+	if err != nil {
+		return authentication.KubernetesCredentials{}, err
 	}
 
-	cmd := exec.Command(*executable, arguments...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	credentials, err := authenticator.AuthenticateWithToken(token)
 	if err != nil {
-		log.Fatal(err)
+		return authentication.KubernetesCredentials{}, err
+	}
+
+	logIssuedCertificate(authenticator.KubernetesUsername, credentials)
+	return credentials, nil
+}
+
+func logIssuedCertificate(commonName string, credentials authentication.KubernetesCredentials) {
+	if certificate, err := DecodeBase64EncodedPEMCertificate(credentials.ClientCertificateData); err == nil {
+		logging.Debugf("Issued certificate for %q with serial %s, expiring at %s", commonName, FormatSerialNumber(certificate.SerialNumber), certificate.NotAfter.Format(time.RFC3339))
 	}
 }
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level controls which messages are written
+type Level int
+
+// Log levels, from least to most verbose
+const (
+	LevelQuiet Level = iota
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+// EnvironmentVariable overrides the configured log level
+const EnvironmentVariable = "KUGO_LOG_LEVEL"
+
+var levelNames = map[string]Level{
+	"quiet": LevelQuiet,
+	"info":  LevelInfo,
+	"debug": LevelDebug,
+	"trace": LevelTrace,
+}
+
+var (
+	mutex  sync.Mutex
+	level            = LevelInfo
+	output io.Writer = os.Stderr
+)
+
+// ParseLevel converts the name of a log level into a Level
+func ParseLevel(name string) (Level, error) {
+	parsed, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("unknown log level %q, expected one of quiet, info, debug or trace", name)
+	}
+
+	return parsed, nil
+}
+
+// SetLevel changes which messages are written
+func SetLevel(newLevel Level) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	level = newLevel
+}
+
+// SetOutput changes where messages are written. Messages go to stderr by default, so that they never mix with the
+// output of a wrapped executable.
+func SetOutput(newOutput io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	output = newOutput
+}
+
+// Configure sets the log level and optional log file. The KUGO_LOG_LEVEL environment variable takes precedence over
+// the given level. Messages are written to the log file as well as stderr.
+func Configure(levelName string, logFile string) error {
+	if environmentLevel := os.Getenv(EnvironmentVariable); environmentLevel != "" {
+		levelName = environmentLevel
+	}
+
+	if levelName != "" {
+		parsed, err := ParseLevel(levelName)
+		if err != nil {
+			return err
+		}
+
+		SetLevel(parsed)
+	}
+
+	if logFile != "" {
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+
+		SetOutput(io.MultiWriter(os.Stderr, file))
+	}
+
+	return nil
+}
+
+// Enabled reports whether messages at the given level are written
+func Enabled(messageLevel Level) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return messageLevel <= level
+}
+
+func logf(messageLevel Level, format string, arguments ...interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if messageLevel > level {
+		return
+	}
+
+	fmt.Fprintf(output, "[kugo] "+format+"\n", arguments...)
+}
+
+// Warnf writes a warning about something the user should fix. Warnings are shown even when kugo is quiet, as they
+// may concern the safety of the user's credentials.
+func Warnf(format string, arguments ...interface{}) {
+	logf(LevelQuiet, "WARNING: "+format, arguments...)
+}
+
+// Infof writes a message which is shown unless kugo is quiet
+func Infof(format string, arguments ...interface{}) {
+	logf(LevelInfo, format, arguments...)
+}
+
+// Debugf writes a message describing the decisions kugo makes, such as which profile was used. Secrets must never be
+// passed to Debugf.
+func Debugf(format string, arguments ...interface{}) {
+	logf(LevelDebug, format, arguments...)
+}
+
+// Tracef writes detailed messages useful when diagnosing problems with kugo itself. Secrets must never be passed to
+// Tracef.
+func Tracef(format string, arguments ...interface{}) {
+	logf(LevelTrace, format, arguments...)
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevelFiltering(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	SetOutput(buffer)
+	SetLevel(LevelInfo)
+	defer SetOutput(os.Stderr)
+
+	Infof("shown %d", 1)
+	Debugf("hidden")
+
+	if buffer.String() != "[kugo] shown 1\n" {
+		t.Errorf("Incorrect log output %q", buffer.String())
+	}
+
+	buffer.Reset()
+	SetLevel(LevelQuiet)
+	defer SetLevel(LevelInfo)
+	Infof("hidden")
+
+	if buffer.Len() != 0 {
+		t.Error("Quiet level wrote a message")
+	}
+
+	Warnf("shown %d", 2)
+
+	if buffer.String() != "[kugo] WARNING: shown 2\n" {
+		t.Errorf("Quiet level hid a warning, wrote %q", buffer.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("DEBUG")
+	if err != nil || level != LevelDebug {
+		t.Error("Could not parse debug level")
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Did not error on unknown level")
+	}
+}
+
+func TestEnvironmentOverridesConfiguredLevel(t *testing.T) {
+	os.Setenv(EnvironmentVariable, "trace")
+	defer os.Unsetenv(EnvironmentVariable)
+	defer SetLevel(LevelInfo)
+
+	if err := Configure("quiet", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Enabled(LevelTrace) {
+		t.Error("KUGO_LOG_LEVEL did not override the configured level")
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	logFile := filepath.Join(directory, "kugo.log")
+	defer SetOutput(os.Stderr)
+	defer SetLevel(LevelInfo)
+
+	if err := Configure("debug", logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	Debugf("written to file")
+
+	contents, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(contents), "written to file") {
+		t.Error("Message was not written to the log file")
+	}
+}
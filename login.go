@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+)
+
+// loginMethod selects the Vault login strategy named by the profile's vault_auth_method, reading the secrets it needs
+func loginMethod(profile configuration.Profile) (authentication.LoginMethod, error) {
+	auth := profile.VaultAuth
+
+	switch profile.VaultAuthMethod {
+	case configuration.AuthMethodUserpass:
+		password, err := auth.Userpass.Password.Resolve(fmt.Sprintf("Vault password for %s", auth.Userpass.Username))
+		if err != nil {
+			return nil, err
+		}
+
+		return &authentication.UserpassLogin{
+			Mount:    auth.Userpass.Mount,
+			Username: auth.Userpass.Username,
+			Password: password,
+		}, nil
+	case configuration.AuthMethodAppRole:
+		secretID, err := auth.AppRole.SecretID.Resolve("Vault AppRole secret ID")
+		if err != nil {
+			return nil, err
+		}
+
+		return &authentication.AppRoleLogin{
+			Mount:    auth.AppRole.Mount,
+			RoleID:   auth.AppRole.RoleID,
+			SecretID: secretID,
+		}, nil
+	case configuration.AuthMethodLDAP:
+		password, err := auth.LDAP.Password.Resolve(fmt.Sprintf("LDAP password for %s", auth.LDAP.Username))
+		if err != nil {
+			return nil, err
+		}
+
+		return &authentication.LDAPLogin{
+			Mount:    auth.LDAP.Mount,
+			Username: auth.LDAP.Username,
+			Password: password,
+		}, nil
+	case configuration.AuthMethodOIDC:
+		var timeout time.Duration
+		if auth.OIDC.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(auth.OIDC.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid OIDC timeout %q: %w", auth.OIDC.Timeout, err)
+			}
+		}
+
+		return &authentication.OIDCLogin{
+			Mount:         auth.OIDC.Mount,
+			Role:          auth.OIDC.Role,
+			ListenAddress: auth.OIDC.ListenAddress,
+			Timeout:       timeout,
+			SkipBrowser:   auth.OIDC.SkipBrowser,
+		}, nil
+	case configuration.AuthMethodCert:
+		return &authentication.CertLogin{
+			Mount: auth.Cert.Mount,
+			Role:  auth.Cert.Role,
+		}, nil
+	case configuration.AuthMethodKubernetes:
+		return &authentication.KubernetesLogin{
+			Mount:     auth.Kubernetes.Mount,
+			Role:      auth.Kubernetes.Role,
+			TokenPath: auth.Kubernetes.TokenPath,
+		}, nil
+	case configuration.AuthMethodJWT:
+		jwt, err := auth.JWT.JWT.Resolve("JWT")
+		if err != nil {
+			return nil, err
+		}
+
+		return &authentication.JWTLogin{
+			Mount: auth.JWT.Mount,
+			Role:  auth.JWT.Role,
+			JWT:   jwt,
+		}, nil
+	case configuration.AuthMethodToken:
+		token, err := auth.Token.Token.Resolve("Vault token")
+		if err != nil {
+			return nil, err
+		}
+
+		return &authentication.TokenLogin{
+			Token: token,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported Vault authentication method %q", profile.VaultAuthMethod)
+}
+
+// deferredLoginMethod selects the profile's login method only once a login is needed, so that a valid cached token
+// avoids reading or prompting for secrets
+func deferredLoginMethod(profile configuration.Profile) authentication.LoginMethod {
+	return authentication.DeferredLogin(func() (authentication.LoginMethod, error) {
+		return loginMethod(profile)
+	})
+}
+
+// tokenCache returns the cache for the profile's Vault tokens, or nil if they shouldn't be cached. A configured token
+// is already reusable, so there's nothing to gain from caching it, and CI tokens are only cached when asked for.
+func tokenCache(profile configuration.Profile) *authentication.TokenCache {
+	auth := profile.VaultAuth
+
+	switch profile.VaultAuthMethod {
+	case configuration.AuthMethodToken:
+		return nil
+	case configuration.AuthMethodKubernetes:
+		if !auth.Kubernetes.CacheToken {
+			return nil
+		}
+	case configuration.AuthMethodJWT:
+		if !auth.JWT.CacheToken {
+			return nil
+		}
+	}
+
+	return &authentication.TokenCache{
+		Directory: authentication.DefaultTokenCacheDirectory(),
+		Identity:  loginIdentity(profile),
+	}
+}
+
+// loginIdentity describes who the profile logs in to Vault as, from its auth method, mount and username or role, so
+// that profiles logging in as someone else never reuse each other's tokens
+func loginIdentity(profile configuration.Profile) string {
+	auth := profile.VaultAuth
+
+	var mount, defaultMount, principal string
+	switch profile.VaultAuthMethod {
+	case configuration.AuthMethodUserpass:
+		mount, defaultMount, principal = auth.Userpass.Mount, authentication.DefaultUserpassMount, auth.Userpass.Username
+	case configuration.AuthMethodAppRole:
+		mount, defaultMount, principal = auth.AppRole.Mount, authentication.DefaultAppRoleMount, auth.AppRole.RoleID
+	case configuration.AuthMethodLDAP:
+		mount, defaultMount, principal = auth.LDAP.Mount, authentication.DefaultLDAPMount, auth.LDAP.Username
+	case configuration.AuthMethodOIDC:
+		mount, defaultMount, principal = auth.OIDC.Mount, authentication.DefaultOIDCMount, auth.OIDC.Role
+	case configuration.AuthMethodCert:
+		clientCert := profile.VaultTLS.ClientCert
+		if auth.Cert.ClientCert != "" {
+			clientCert = auth.Cert.ClientCert
+		}
+
+		mount, defaultMount, principal = auth.Cert.Mount, authentication.DefaultCertMount, auth.Cert.Role+" "+clientCert
+	case configuration.AuthMethodKubernetes:
+		mount, defaultMount, principal = auth.Kubernetes.Mount, authentication.DefaultKubernetesMount, auth.Kubernetes.Role
+	case configuration.AuthMethodJWT:
+		mount, defaultMount, principal = auth.JWT.Mount, authentication.DefaultJWTMount, auth.JWT.Role
+	}
+
+	if mount == "" {
+		mount = defaultMount
+	}
+
+	return fmt.Sprintf("%s %s %s", profile.VaultAuthMethod, mount, principal)
+}
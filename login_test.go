@@ -0,0 +1,227 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+)
+
+var exampleLegacyConfiguration = `
+vault_address: https://vault:8443
+vault_username: kugo
+vault_password: password
+vault_pki_role: kugo-pki
+vault_pki_mount: pki
+kubernetes_pki_ttl: 1d`
+
+var exampleAppRoleConfiguration = `
+vault_address: https://vault:8443
+vault_auth_method: approle
+vault_auth:
+  approle:
+    mount: ci-approle
+    role_id: testRoleID
+    secret_id: testSecretID
+vault_pki_role: kugo-pki
+vault_pki_mount: pki`
+
+func TestLegacyConfigurationUsesUserpass(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(exampleLegacyConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, err := loginMethod(kugoConfiguration.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userpassLogin, ok := method.(*authentication.UserpassLogin)
+	if !ok {
+		t.Fatal("Legacy configuration did not select userpass login")
+	}
+
+	if userpassLogin.Username != "kugo" || userpassLogin.Password != "password" {
+		t.Error("Legacy username and password were not used")
+	}
+}
+
+func TestAppRoleConfigurationUsesAppRole(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(exampleAppRoleConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, err := loginMethod(kugoConfiguration.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appRoleLogin, ok := method.(*authentication.AppRoleLogin)
+	if !ok {
+		t.Fatal("AppRole configuration did not select AppRole login")
+	}
+
+	if appRoleLogin.Mount != "ci-approle" || appRoleLogin.RoleID != "testRoleID" || appRoleLogin.SecretID != "testSecretID" {
+		t.Error("Incorrect AppRole settings parsed")
+	}
+}
+
+func TestUnknownLoginMethod(t *testing.T) {
+	_, err := loginMethod(configuration.Profile{VaultAuthMethod: "carrier-pigeon"})
+	if err == nil {
+		t.Error("Did not error on unknown login method")
+	}
+}
+
+func TestLDAPConfigurationUsesLDAP(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(`
+vault_auth_method: ldap
+vault_auth:
+  ldap:
+    mount: corp-ldap
+    username: jdoe
+    password:
+      env: KUGO_TEST_LDAP_PASSWORD`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("KUGO_TEST_LDAP_PASSWORD", "directoryPassword")
+	defer os.Unsetenv("KUGO_TEST_LDAP_PASSWORD")
+
+	method, err := loginMethod(kugoConfiguration.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ldapLogin, ok := method.(*authentication.LDAPLogin)
+	if !ok {
+		t.Fatal("LDAP configuration did not select LDAP login")
+	}
+
+	if ldapLogin.Mount != "corp-ldap" || ldapLogin.Username != "jdoe" || ldapLogin.Password != "directoryPassword" {
+		t.Error("Incorrect LDAP settings parsed")
+	}
+}
+
+func TestCertConfigurationPresentsClientCertificate(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(`
+vault_auth_method: cert
+vault_tls:
+  ca_cert: /etc/ssl/internal-ca.pem
+vault_auth:
+  cert:
+    role: jump-hosts
+    client_cert: /etc/vault/host.pem
+    client_key: /etc/vault/host-key.pem`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, err := loginMethod(kugoConfiguration.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certLogin, ok := method.(*authentication.CertLogin)
+	if !ok || certLogin.Role != "jump-hosts" {
+		t.Fatal("Cert configuration did not select cert login with the jump-hosts role")
+	}
+
+	authenticator, err := newVaultAuthenticator(kugoConfiguration.Profile, KubernetesContext{}, KubernetesUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if authenticator.TLS.ClientCert != "/etc/vault/host.pem" || authenticator.TLS.ClientKey != "/etc/vault/host-key.pem" {
+		t.Errorf("Client certificate %q and key %q were not presented", authenticator.TLS.ClientCert, authenticator.TLS.ClientKey)
+	}
+
+	if authenticator.TLS.CACert != "/etc/ssl/internal-ca.pem" {
+		t.Error("The rest of vault_tls was not kept")
+	}
+}
+
+func TestJWTConfigurationUsesJWT(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(`
+vault_auth_method: jwt
+vault_auth:
+  jwt:
+    mount: gitlab
+    role: deploy
+    jwt:
+      env: KUGO_TEST_JWT`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("KUGO_TEST_JWT", "ciJobJWT")
+	defer os.Unsetenv("KUGO_TEST_JWT")
+
+	method, err := loginMethod(kugoConfiguration.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtLogin, ok := method.(*authentication.JWTLogin)
+	if !ok {
+		t.Fatal("JWT configuration did not select JWT login")
+	}
+
+	if jwtLogin.Mount != "gitlab" || jwtLogin.Role != "deploy" || jwtLogin.JWT != "ciJobJWT" {
+		t.Error("Incorrect JWT settings parsed")
+	}
+}
+
+func TestTokenCacheIdentity(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(`
+vault_auth:
+  userpass:
+    username: alice
+profiles:
+  bob:
+    vault_auth:
+      userpass:
+        username: bob
+  ci:
+    vault_auth_method: jwt
+    vault_auth:
+      jwt:
+        role: deploy
+  cached-ci:
+    vault_auth_method: kubernetes
+    vault_auth:
+      kubernetes:
+        role: ci
+        cache_token: true
+  token:
+    vault_auth_method: token`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := tokenCache(kugoConfiguration.Profile)
+	bob := tokenCache(kugoConfiguration.Profiles["bob"])
+	if alice == nil || bob == nil || alice.Identity == bob.Identity {
+		t.Errorf("Expected separate token caches for alice and bob, got %+v and %+v", alice, bob)
+	}
+
+	if alice.Identity != "userpass userpass alice" {
+		t.Errorf("Identity for alice was %q", alice.Identity)
+	}
+
+	if cache := tokenCache(kugoConfiguration.Profiles["ci"]); cache != nil {
+		t.Error("JWT tokens were cached without cache_token")
+	}
+
+	if cache := tokenCache(kugoConfiguration.Profiles["cached-ci"]); cache == nil || cache.Identity != "kubernetes kubernetes ci" {
+		t.Errorf("Kubernetes token cache with cache_token was %+v", cache)
+	}
+
+	if cache := tokenCache(kugoConfiguration.Profiles["token"]); cache != nil {
+		t.Error("Configured tokens were cached")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// runExecutable runs the wrapped executable attached to kugo's stdin, stdout and stderr, forwarding any signals kugo
+// receives to it. The executable's exit code is returned so that kugo can exit with the same code.
+func runExecutable(executable string, arguments []string) (int, error) {
+	cmd := exec.Command(executable, arguments...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Start listening before the child starts so that no signal is missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case received := <-signals:
+				cmd.Process.Signal(received)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	if exitError, ok := err.(*exec.ExitError); ok {
+		return exitCode(exitError.ProcessState), nil
+	}
+
+	if err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
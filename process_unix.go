@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// forwardedSignals are passed on from kugo to the wrapped executable
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH}
+
+// exitCode reports the exit code of a finished process, using the shell's convention of 128 plus the signal number
+// for processes killed by a signal
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return state.ExitCode()
+}
+
+// replaceProcess replaces kugo with the wrapped executable, so no kugo process remains while it runs. It only returns
+// if the executable could not be started.
+func replaceProcess(executable string, arguments []string) error {
+	executablePath, err := exec.LookPath(executable)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(executablePath, append([]string{executable}, arguments...), os.Environ())
+}
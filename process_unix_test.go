@@ -0,0 +1,138 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunExecutableExitCode(t *testing.T) {
+	exitCode, err := runExecutable("sh", []string{"-c", "exit 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", exitCode)
+	}
+}
+
+func TestRunExecutableSuccess(t *testing.T) {
+	exitCode, err := runExecutable("true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+}
+
+func TestRunExecutableKilledBySignal(t *testing.T) {
+	exitCode, err := runExecutable("sh", []string{"-c", "kill -TERM $$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 143 {
+		t.Errorf("Expected exit code 143, got %d", exitCode)
+	}
+}
+
+func TestRunExecutableNotFound(t *testing.T) {
+	_, err := runExecutable("kugo-executable-which-does-not-exist", nil)
+	if err == nil {
+		t.Error("Did not error on missing executable")
+	}
+}
+
+func TestRunExecutablePassesStdin(t *testing.T) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdinReader.Close()
+
+	stdout, err := ioutil.TempFile("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+
+	previousStdin, previousStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinReader, stdout
+	defer func() { os.Stdin, os.Stdout = previousStdin, previousStdout }()
+
+	stdinWriter.WriteString("apiVersion: v1\nkind: Pod\n")
+	stdinWriter.Close()
+
+	exitCode, err := runExecutable("cat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+
+	output, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(output) != "apiVersion: v1\nkind: Pod\n" {
+		t.Errorf("Executable did not receive stdin, wrote %q", output)
+	}
+}
+
+func TestRunExecutableForwardsSignals(t *testing.T) {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutReader.Close()
+
+	previousStdout := os.Stdout
+	os.Stdout = stdoutWriter
+	defer func() { os.Stdout = previousStdout }()
+
+	type result struct {
+		exitCode int
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		exitCode, err := runExecutable("sh", []string{"-c", `trap "exit 7" TERM; echo ready; while :; do sleep 0.1; done`})
+		stdoutWriter.Close()
+		results <- result{exitCode, err}
+	}()
+
+	// The trap is in place once the executable has written to stdout
+	if _, err := bufio.NewReader(stdoutReader).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case finished := <-results:
+		if finished.err != nil {
+			t.Fatal(finished.err)
+		}
+
+		if finished.exitCode != 7 {
+			t.Errorf("Expected the executable to handle the forwarded SIGTERM and exit with 7, got %d", finished.exitCode)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("SIGTERM was not forwarded to the executable")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// forwardedSignals are passed on from kugo to the wrapped executable
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// exitCode reports the exit code of a finished process
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
+
+// replaceProcess is not supported on Windows, which has no equivalent of exec
+func replaceProcess(executable string, arguments []string) error {
+	return errors.New("replacing the kugo process is not supported on Windows")
+}
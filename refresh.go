@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/bnmcg/kugo/authentication"
+	"github.com/bnmcg/kugo/configuration"
+	"github.com/bnmcg/kugo/logging"
+)
+
+// DefaultRefreshConcurrency is the number of certificates requested from Vault at once when refreshing many contexts
+const DefaultRefreshConcurrency = 4
+
+// refreshTarget is a kubeconfig user to refresh, along with every selected context which uses it
+type refreshTarget struct {
+	User     KubernetesUser
+	Context  KubernetesContext
+	Contexts []string
+	Profile  configuration.Profile
+}
+
+// refreshResult records the outcome of refreshing a single context
+type refreshResult struct {
+	Context string
+	User    string
+	Profile string
+	Err     error
+}
+
+// loginKey identifies the Vault settings a token is valid for, so that profiles which only differ in their PKI
+// settings share a login
+type loginKey struct {
+	Address   string
+	TLS       configuration.VaultTLSConfiguration
+	Namespace string
+	Method    string
+	Auth      configuration.VaultAuthConfiguration
+}
+
+func loginKeyFor(profile configuration.Profile) loginKey {
+	return loginKey{
+		Address:   profile.VaultAddress,
+		TLS:       profile.VaultTLS,
+		Namespace: profile.VaultAuthNamespace,
+		Method:    profile.VaultAuthMethod,
+		Auth:      profile.VaultAuth,
+	}
+}
+
+// selectRefreshTargets finds the kugo managed users of the contexts matching any of the patterns. A user is managed by
+// kugo when it authenticates with a client certificate. Each user is refreshed once, using the profile of the first
+// context which selected it.
+func selectRefreshTargets(kubeconfig KubernetesConfiguration, kugoConfiguration configuration.KugoConfiguration, patterns []string) []refreshTarget {
+	users := map[string]KubernetesUser{}
+	for _, user := range kubeconfig.Users {
+		users[user.Name] = user
+	}
+
+	targets := []refreshTarget{}
+	targetIndexes := map[string]int{}
+	for _, context := range kubeconfig.Contexts {
+		if !matchesAnyPattern(context.Name, patterns) {
+			continue
+		}
+
+		user, ok := users[context.Context.User]
+		if !ok || user.User.ClientCertificateData == "" {
+			logging.Debugf("Skipping context %q, its user is not managed by kugo", context.Name)
+			continue
+		}
+
+		if index, ok := targetIndexes[user.Name]; ok {
+			targets[index].Contexts = append(targets[index].Contexts, context.Name)
+			continue
+		}
+
+		targetIndexes[user.Name] = len(targets)
+		targets = append(targets, refreshTarget{
+			User:     user,
+			Context:  context,
+			Contexts: []string{context.Name},
+			Profile:  kugoConfiguration.ProfileFor(context.Name, context.Context.Cluster),
+		})
+	}
+
+	return targets
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refreshContexts issues new credentials for the users of every context matching the patterns. Vault is logged in to
+// once for each distinct set of Vault settings, then certificates are requested with up to concurrency requests in
+// flight. Every new credential is written back to the kubeconfig in a single update.
+func refreshContexts(kugoConfiguration configuration.KugoConfiguration, selection KubernetesSelection, patterns []string, concurrency int) ([]refreshResult, error) {
+	kubeconfigPaths, kubeconfig, err := loadSelectedKubeconfig(selection)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := selectRefreshTargets(kubeconfig, kugoConfiguration, patterns)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no kugo managed contexts match %s", strings.Join(patterns, ","))
+	}
+
+	// Logins happen one at a time, as they may prompt for input
+	tokens := map[loginKey]string{}
+	loginErrors := map[loginKey]error{}
+	for _, target := range targets {
+		key := loginKeyFor(target.Profile)
+		if _, ok := tokens[key]; ok {
+			continue
+		}
+
+		if _, ok := loginErrors[key]; ok {
+			continue
+		}
+
+		token, err := loginToVault(target.Profile, target.Context, target.User)
+		if err != nil {
+			loginErrors[key] = err
+			continue
+		}
+
+		tokens[key] = token
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	credentials := make([]authentication.KubernetesCredentials, len(targets))
+	targetErrors := make([]error, len(targets))
+
+	waitGroup := sync.WaitGroup{}
+	semaphore := make(chan struct{}, concurrency)
+	for index, target := range targets {
+		key := loginKeyFor(target.Profile)
+		if err, ok := loginErrors[key]; ok {
+			targetErrors[index] = err
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(index int, target refreshTarget, token string) {
+			defer waitGroup.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			credentials[index], targetErrors[index] = issueWithToken(target.Profile, target.Context, target.User, token)
+		}(index, target, tokens[key])
+	}
+	waitGroup.Wait()
+
+	updates := map[string]authentication.KubernetesCredentials{}
+	for index, target := range targets {
+		if targetErrors[index] == nil {
+			updates[target.User.Name] = credentials[index]
+		}
+	}
+
+	if len(updates) > 0 {
+		err = UpdateKubeconfigUsers(kubeconfigPaths, updates, kugoConfiguration.KubeconfigBackups)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := []refreshResult{}
+	for index, target := range targets {
+		for _, context := range target.Contexts {
+			results = append(results, refreshResult{
+				Context: context,
+				User:    target.User.Name,
+				Profile: target.Profile.Name,
+				Err:     targetErrors[index],
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// writeRefreshSummary writes the outcome of refreshing each context and returns the number which failed
+func writeRefreshSummary(output io.Writer, results []refreshResult) (int, error) {
+	failed := 0
+
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CONTEXT\tUSER\tPROFILE\tRESULT")
+	for _, result := range results {
+		outcome := "refreshed"
+		if result.Err != nil {
+			outcome = fmt.Sprintf("failed: %s", explainError(result.Err))
+			failed++
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.Context, result.User, result.Profile, outcome)
+	}
+
+	return failed, writer.Flush()
+}
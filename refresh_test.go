@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bnmcg/kugo/configuration"
+)
+
+// fakeVault serves userpass logins and PKI issuance, counting the requests it receives
+type fakeVault struct {
+	*httptest.Server
+	logins    int32
+	issuances int32
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	vault := &fakeVault{}
+	vault.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/auth/userpass/login/"):
+			atomic.AddInt32(&vault.logins, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case strings.HasPrefix(r.URL.Path, "/v1/pki/issue/"):
+			atomic.AddInt32(&vault.issuances, 1)
+			if r.Header.Get("X-Vault-Token") != "test-token" {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+				return
+			}
+
+			request := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&request)
+			credentials := generateTestCredentials(t, request["common_name"].(string), time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+			certificate, _ := base64.StdEncoding.DecodeString(credentials.ClientCertificateData)
+			privateKey, _ := base64.StdEncoding.DecodeString(credentials.ClientKeyData)
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"certificate": string(certificate), "private_key": string(privateKey)},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return vault
+}
+
+func TestRefreshContexts(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	cacheDirectory, err := ioutil.TempDir("", "kugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDirectory)
+
+	previousCacheHome := os.Getenv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", cacheDirectory)
+	defer os.Setenv("XDG_CACHE_HOME", previousCacheHome)
+
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(fmt.Sprintf(`
+vault_address: %s
+vault_username: test
+vault_password: test
+vault_pki_mount: pki
+vault_pki_role: kugo
+profiles:
+  "*admin2*":
+    vault_pki_role: other
+`, vault.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := writeTestKubeconfigs(t, exampleMultipleClusterConfiguration)
+	defer os.RemoveAll(directory)
+	kubeconfigPath := filepath.Join(directory, "config0")
+
+	results, err := refreshContexts(kugoConfiguration, KubernetesSelection{Kubeconfig: kubeconfigPath}, []string{"*"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected results for 2 contexts, got %d", len(results))
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("Context %s failed to refresh: %s", result.Context, result.Err)
+		}
+	}
+
+	if vault.logins != 1 || vault.issuances != 2 {
+		t.Errorf("Expected 1 login and 2 issuances, got %d and %d", vault.logins, vault.issuances)
+	}
+
+	kubeconfig, err := LoadKubeconfigFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range kubeconfig.Users {
+		certificate, err := DecodeBase64EncodedPEMCertificate(user.User.ClientCertificateData)
+		if err != nil || certificate.Subject.CommonName != user.Name {
+			t.Errorf("User %s was not written back with a new certificate", user.Name)
+		}
+	}
+}
+
+func TestRefreshCredentialsSkipsUnmanagedUser(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(fmt.Sprintf(`
+vault_address: %s
+vault_username: test
+vault_password: test
+vault_pki_mount: pki
+vault_pki_role: kugo
+`, vault.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execConfiguration := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://eks.example.com
+  name: eks
+contexts:
+- context:
+    cluster: eks
+    user: eks-user
+  name: eks
+current-context: eks
+users:
+- name: eks-user
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: aws
+      args: ["eks", "get-token", "--cluster-name", "eks"]
+`
+
+	directory := writeTestKubeconfigs(t, execConfiguration)
+	defer os.RemoveAll(directory)
+	kubeconfigPath := filepath.Join(directory, "config0")
+
+	for _, force := range []bool{false, true} {
+		if err := refreshCredentials(kugoConfiguration, KubernetesSelection{Kubeconfig: kubeconfigPath}, force); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(contents) != execConfiguration {
+		t.Errorf("Kubeconfig of an exec user was changed:\n%s", contents)
+	}
+
+	if vault.logins != 0 || vault.issuances != 0 {
+		t.Errorf("Expected no requests to Vault, got %d logins and %d issuances", vault.logins, vault.issuances)
+	}
+}
+
+func TestSelectRefreshTargets(t *testing.T) {
+	config, err := ParseKubeconfig([]byte(exampleMultipleClusterConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Contexts = append(config.Contexts, KubernetesContext{
+		Name:    "second-admin-context",
+		Context: KubernetesContextDetails{Cluster: "kubernetes", User: "kubernetes-admin"},
+	})
+	config.Users[1].User.ClientCertificateData = ""
+
+	targets := selectRefreshTargets(config, configuration.KugoConfiguration{}, []string{"*"})
+	if len(targets) != 1 {
+		t.Fatalf("Expected 1 target, got %d", len(targets))
+	}
+
+	if targets[0].User.Name != "kubernetes-admin" || len(targets[0].Contexts) != 2 {
+		t.Error("Contexts sharing a user were not refreshed together")
+	}
+
+	targets = selectRefreshTargets(config, configuration.KugoConfiguration{}, []string{"second-*"})
+	if len(targets) != 1 || targets[0].Context.Name != "second-admin-context" {
+		t.Error("Did not select the contexts matching the pattern")
+	}
+}
+
+func TestWriteRefreshSummary(t *testing.T) {
+	output := &bytes.Buffer{}
+	failed, err := writeRefreshSummary(output, []refreshResult{
+		{Context: "prod-1", User: "admin", Profile: "prod"},
+		{Context: "prod-2", User: "admin2", Profile: "prod", Err: errors.New("permission denied")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed != 1 {
+		t.Errorf("Expected 1 failure, got %d", failed)
+	}
+
+	if !strings.Contains(output.String(), "failed: permission denied") {
+		t.Error("Summary did not include the failure")
+	}
+}
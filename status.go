@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bnmcg/kugo/configuration"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by the status command
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// CredentialStatus describes the client certificate of a kubeconfig user
+type CredentialStatus struct {
+	User       string     `json:"user" yaml:"user"`
+	Contexts   []string   `json:"contexts" yaml:"contexts"`
+	Profile    string     `json:"profile,omitempty" yaml:"profile,omitempty"`
+	CommonName string     `json:"commonName,omitempty" yaml:"commonName,omitempty"`
+	Groups     []string   `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Serial     string     `json:"serial,omitempty" yaml:"serial,omitempty"`
+	Issuer     string     `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	NotBefore  *time.Time `json:"notBefore,omitempty" yaml:"notBefore,omitempty"`
+	NotAfter   *time.Time `json:"notAfter,omitempty" yaml:"notAfter,omitempty"`
+	Remaining  string     `json:"remaining,omitempty" yaml:"remaining,omitempty"`
+	Expired    bool       `json:"expired" yaml:"expired"`
+	KeyType    string     `json:"keyType,omitempty" yaml:"keyType,omitempty"`
+	KeyMatches bool       `json:"keyMatches" yaml:"keyMatches"`
+	Error      string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// CredentialStatuses describes the client certificate of every user in the kubeconfig, along with the contexts which
+// use it and the kugo profile which manages it. Users without a client certificate, such as exec or token users, aren't
+// managed by kugo and so have no profile.
+func CredentialStatuses(kubeconfig KubernetesConfiguration, kugoConfiguration configuration.KugoConfiguration) []CredentialStatus {
+	statuses := []CredentialStatus{}
+
+	for _, user := range kubeconfig.Users {
+		status := CredentialStatus{User: user.Name, Contexts: []string{}}
+
+		var firstContext *KubernetesContext
+		for index, context := range kubeconfig.Contexts {
+			if context.Context.User == user.Name {
+				status.Contexts = append(status.Contexts, context.Name)
+				if firstContext == nil {
+					firstContext = &kubeconfig.Contexts[index]
+				}
+			}
+		}
+
+		if user.User.ClientCertificateData == "" {
+			status.Error = "no client certificate"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		if firstContext != nil {
+			status.Profile = kugoConfiguration.ProfileFor(firstContext.Name, firstContext.Context.Cluster).Name
+		} else {
+			status.Profile = kugoConfiguration.Profile.Name
+		}
+
+		certificate, err := DecodeBase64EncodedPEMCertificate(user.User.ClientCertificateData)
+		if err != nil {
+			status.Error = fmt.Sprintf("no valid client certificate: %s", err)
+			statuses = append(statuses, status)
+			continue
+		}
+
+		status.CommonName = certificate.Subject.CommonName
+		status.Groups = certificate.Subject.Organization
+		status.Serial = FormatSerialNumber(certificate.SerialNumber)
+		status.Issuer = certificate.Issuer.String()
+		notBefore, notAfter := certificate.NotBefore.UTC(), certificate.NotAfter.UTC()
+		status.NotBefore = &notBefore
+		status.NotAfter = &notAfter
+		status.Remaining = formatRemaining(certificate.NotAfter)
+		status.Expired = CertificateHasExpired(certificate)
+		status.KeyType = describePublicKey(certificate)
+		status.KeyMatches = keyMatchesCertificate(user.User.ClientCertificateData, user.User.ClientKeyData)
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// describePublicKey names the type and size of a certificate's public key
+func describePublicKey(certificate *x509.Certificate) string {
+	switch publicKey := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", publicKey.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA-%s", publicKey.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+
+	return certificate.PublicKeyAlgorithm.String()
+}
+
+// keyMatchesCertificate checks that the base64 encoded PEM private key belongs to the certificate
+func keyMatchesCertificate(certificateData string, keyData string) bool {
+	certificatePEM, err := base64.StdEncoding.DecodeString(certificateData)
+	if err != nil {
+		return false
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(keyData)
+	if err != nil {
+		return false
+	}
+
+	_, err = tls.X509KeyPair(certificatePEM, keyPEM)
+	return err == nil
+}
+
+// formatRemaining describes how long is left until the given time, rounded to the second
+func formatRemaining(expiry time.Time) string {
+	remaining := expiry.Sub(time.Now()).Round(time.Second)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s ago", -remaining)
+	}
+
+	return fmt.Sprintf("%s remaining", remaining)
+}
+
+// WriteCredentialStatuses writes the statuses in the given output format
+func WriteCredentialStatuses(output io.Writer, statuses []CredentialStatus, format string) error {
+	switch format {
+	case outputTable:
+		return writeCredentialStatusTable(output, statuses)
+	case outputJSON:
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	case outputYAML:
+		encoder := yaml.NewEncoder(output)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(statuses); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+	}
+
+	return fmt.Errorf("unsupported output format %q, expected table, json or yaml", format)
+}
+
+func writeCredentialStatusTable(output io.Writer, statuses []CredentialStatus) error {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "USER\tCONTEXTS\tPROFILE\tCOMMON NAME\tGROUPS\tSERIAL\tISSUER\tNOT BEFORE\tNOT AFTER\tREMAINING\tKEY\tKEY MATCHES")
+
+	for _, status := range statuses {
+		if status.Error != "" {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", status.User, joinOrDash(status.Contexts), orDash(status.Profile), status.Error)
+			continue
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+			status.User,
+			joinOrDash(status.Contexts),
+			status.Profile,
+			status.CommonName,
+			joinOrDash(status.Groups),
+			status.Serial,
+			status.Issuer,
+			status.NotBefore.Format(time.RFC3339),
+			status.NotAfter.Format(time.RFC3339),
+			status.Remaining,
+			status.KeyType,
+			status.KeyMatches,
+		)
+	}
+
+	return writer.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func joinOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	return strings.Join(values, ",")
+}
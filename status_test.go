@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnmcg/kugo/configuration"
+)
+
+func statusTestKubeconfig(t *testing.T) KubernetesConfiguration {
+	config, err := ParseKubeconfig([]byte(exampleMultipleClusterConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := generateTestCredentials(t, "kubernetes-admin", time.Now().UTC().Add(-time.Hour), time.Now().UTC().Add(time.Hour))
+	other := generateTestCredentials(t, "kubernetes-admin2", time.Now().UTC().Add(-2*time.Hour), time.Now().UTC().Add(-time.Hour))
+
+	config.Users[0].User = valid
+	config.Users[1].User = other
+	config.Users[1].User.ClientKeyData = valid.ClientKeyData
+
+	return config
+}
+
+func TestCredentialStatuses(t *testing.T) {
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(exampleLegacyConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := CredentialStatuses(statusTestKubeconfig(t), kugoConfiguration)
+	if len(statuses) != 2 {
+		t.Fatal("Incorrect number of statuses")
+	}
+
+	valid := statuses[0]
+	if valid.User != "kubernetes-admin" || valid.CommonName != "kubernetes-admin" {
+		t.Error("Incorrect user or common name")
+	}
+
+	if len(valid.Contexts) != 1 || valid.Contexts[0] != "kubernetes-admin@kubernetes" {
+		t.Error("Incorrect contexts")
+	}
+
+	if valid.Profile != configuration.DefaultProfileName {
+		t.Error("Incorrect profile")
+	}
+
+	if valid.Serial != "01" || valid.KeyType != "ECDSA-P-256" {
+		t.Errorf("Incorrect serial %s or key type %s", valid.Serial, valid.KeyType)
+	}
+
+	if valid.Expired || !valid.KeyMatches {
+		t.Error("Valid certificate was reported as expired or with a mismatched key")
+	}
+
+	expired := statuses[1]
+	if !expired.Expired || expired.KeyMatches {
+		t.Error("Expired certificate with a mismatched key was reported as valid")
+	}
+
+	if !strings.HasPrefix(expired.Remaining, "expired") {
+		t.Error("Expired certificate did not report how long ago it expired")
+	}
+}
+
+func TestCredentialStatusWithoutCertificate(t *testing.T) {
+	config, err := ParseKubeconfig([]byte(exampleSingleClusterConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := CredentialStatuses(config, configuration.KugoConfiguration{})
+	if len(statuses) != 1 || statuses[0].Error == "" {
+		t.Error("Invalid certificate did not report an error")
+	}
+}
+
+func TestCredentialStatusOutputFormats(t *testing.T) {
+	statuses := CredentialStatuses(statusTestKubeconfig(t), configuration.KugoConfiguration{})
+
+	output := &bytes.Buffer{}
+	if err := WriteCredentialStatuses(output, statuses, outputJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := []CredentialStatus{}
+	if err := json.Unmarshal(output.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed) != 2 || parsed[0].User != "kubernetes-admin" {
+		t.Error("Incorrect JSON output")
+	}
+
+	for _, format := range []string{outputTable, outputYAML} {
+		output.Reset()
+		if err := WriteCredentialStatuses(output, statuses, format); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(output.String(), "kubernetes-admin2") {
+			t.Errorf("%s output is missing a user", format)
+		}
+	}
+
+	if err := WriteCredentialStatuses(output, statuses, "xml"); err == nil {
+		t.Error("Did not error on unsupported output format")
+	}
+}
+
+func TestCredentialStatusOfUnmanagedUser(t *testing.T) {
+	config, err := ParseKubeconfig([]byte(exampleConfigurationWithUnmodelledFields))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kugoConfiguration, err := configuration.ParseConfiguration([]byte(exampleLegacyConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := CredentialStatuses(config, kugoConfiguration)
+	if len(statuses) != 2 {
+		t.Fatal("Incorrect number of statuses")
+	}
+
+	if statuses[0].Profile != configuration.DefaultProfileName || statuses[1].Profile != "" {
+		t.Errorf("Token user was given profile %q", statuses[1].Profile)
+	}
+
+	output := &bytes.Buffer{}
+	if err := WriteCredentialStatuses(output, statuses, outputJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := []map[string]interface{}{}
+	if err := json.Unmarshal(output.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range parsed {
+		for _, field := range []string{"notBefore", "notAfter"} {
+			if _, ok := status[field]; ok {
+				t.Errorf("User %s without a valid certificate has %s %v", status["user"], field, status[field])
+			}
+		}
+	}
+
+	if _, ok := parsed[1]["profile"]; ok {
+		t.Error("Token user has a profile in the JSON output")
+	}
+}